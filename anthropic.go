@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+const defaultAnthropicURL = "https://api.anthropic.com/v1"
+const anthropicVersion = "2023-06-01"
+
+// anthropicProvider serves Claude models through the Messages API
+type anthropicProvider struct {
+	url string
+	key string
+}
+
+func newAnthropicProvider(base string, primary bool) (*anthropicProvider, error) {
+	key, err := vendorKey("anthropic", "ANTHROPIC_API_KEY", primary)
+	if err != nil {
+		return nil, err
+	}
+	p := &anthropicProvider{url: defaultAnthropicURL, key: key}
+	if base != "" {
+		p.url = strings.TrimRight(base, "/")
+	}
+	return p, nil
+}
+
+type anthropicBlock struct {
+	Type   string                `json:"type"`
+	Text   string                `json:"text,omitempty"`
+	Source *anthropicImageSource `json:"source,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          float64            `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	Metadata      *struct {
+		UserID string `json:"user_id"`
+	} `json:"metadata,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicResponse struct {
+	Content []anthropicBlock `json:"content"`
+	Usage   anthropicUsage   `json:"usage"`
+}
+
+type anthropicError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// newAnthropicRequest maps the messages to the Messages API, where the system
+// prompt is separate and the roles alternate, so consecutive turns of a role are merged
+func newAnthropicRequest(messages []gpt3.ChatCompletionMessage, opts ChatOptions) anthropicRequest {
+	req := anthropicRequest{
+		Model:         Model,
+		MaxTokens:     opts.MaxTokens,
+		StopSequences: Stop,
+	}
+	// newer models refuse both, so top_p takes the place of the temperature when it was lowered
+	if TopP < 1 {
+		req.TopP = TopP
+	} else {
+		temp := Temp
+		req.Temperature = &temp
+	}
+	if User != "" {
+		req.Metadata = &struct {
+			UserID string `json:"user_id"`
+		}{User}
+	}
+
+	var system []string
+	for _, m := range attachImages(messages) {
+		text := m.Content
+		if CleanPrompt {
+			text = cleanText(text)
+		}
+		if m.Role == gpt3.ChatMessageRoleSystem {
+			system = append(system, text)
+			continue
+		}
+
+		var blocks []anthropicBlock
+		if text != "" {
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+		}
+		for _, p := range m.MultiContent {
+			if p.Type == gpt3.ChatMessagePartTypeText && p.Text != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: p.Text})
+			} else if p.Type == gpt3.ChatMessagePartTypeImageURL {
+				blocks = append(blocks, anthropicImage(p.ImageURL.URL))
+			}
+		}
+		// the API rejects empty content
+		if len(blocks) == 0 {
+			continue
+		}
+
+		n := len(req.Messages)
+		if n > 0 && req.Messages[n-1].Role == m.Role {
+			req.Messages[n-1].Content = append(req.Messages[n-1].Content, blocks...)
+		} else {
+			req.Messages = append(req.Messages, anthropicMessage{Role: m.Role, Content: blocks})
+		}
+	}
+	req.System = strings.Join(system, "\n\n")
+	return req
+}
+
+// anthropicImage sends data URLs as base64 sources and others as URLs
+func anthropicImage(url string) anthropicBlock {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		mediaType, data, _ := strings.Cut(rest, ";base64,")
+		return anthropicBlock{Type: "image", Source: &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}}
+	}
+	return anthropicBlock{Type: "image", Source: &anthropicImageSource{Type: "url", URL: url}}
+}
+
+// post sends the request, returning API errors as the
+// client would, so they are explained the same way
+func (p *anthropicProvider) post(ctx context.Context, req anthropicRequest) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("x-api-key", p.key)
+	r.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := apiHTTPClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var e anthropicError
+		if json.Unmarshal(b, &e) != nil || e.Error.Message == "" {
+			e.Error.Message = strings.TrimSpace(string(b))
+		}
+		return nil, &gpt3.APIError{Type: e.Error.Type, Message: e.Error.Message, HTTPStatusCode: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// complete returns the text of the response to req
+func (p *anthropicProvider) complete(ctx context.Context, req anthropicRequest) (string, anthropicUsage, error) {
+	resp, err := p.post(ctx, req)
+	if err != nil {
+		return "", anthropicUsage{}, err
+	}
+	defer resp.Body.Close()
+	var ar anthropicResponse
+	err = json.NewDecoder(resp.Body).Decode(&ar)
+	if err != nil {
+		return "", anthropicUsage{}, err
+	}
+
+	var text string
+	for _, b := range ar.Content {
+		if b.Type == "text" {
+			text += b.Text
+		}
+	}
+	return text, ar.Usage, nil
+}
+
+// Chat sends the messages to a Claude model. The API has
+// no choices, so opts.Count makes one request per response
+func (p *anthropicProvider) Chat(ctx context.Context, messages []gpt3.ChatCompletionMessage, opts ChatOptions) ([]string, error) {
+	req := newAnthropicRequest(messages, opts)
+	var r []string
+	for i := 0; i < opts.Count; i++ {
+		text, usage, err := p.complete(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, text)
+		LastUsage.PromptTokens += usage.InputTokens
+		LastUsage.CompletionTokens += usage.OutputTokens
+		LastUsage.TotalTokens += usage.InputTokens + usage.OutputTokens
+	}
+	return r, nil
+}
+
+// Stream writes the text deltas of the event stream to w,
+// the stream reports usage, so it does not have to be estimated
+func (p *anthropicProvider) Stream(ctx context.Context, messages []gpt3.ChatCompletionMessage, w io.Writer) (string, error) {
+	req := newAnthropicRequest(messages, chatFlags())
+	req.Stream = true
+	resp, err := p.post(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	text := ""
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event struct {
+			Type    string `json:"type"`
+			Message struct {
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			Delta struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"delta"`
+			Usage anthropicUsage `json:"usage"`
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return text, err
+		}
+
+		switch event.Type {
+		case "message_start":
+			LastUsage.PromptTokens = event.Message.Usage.InputTokens
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" {
+				fmt.Fprint(w, event.Delta.Text)
+				text += event.Delta.Text
+			}
+		case "message_delta":
+			LastUsage.CompletionTokens = event.Usage.OutputTokens
+		case "error":
+			return text, &gpt3.APIError{Type: event.Error.Type, Message: event.Error.Message}
+		}
+	}
+	LastUsage.TotalTokens = LastUsage.PromptTokens + LastUsage.CompletionTokens
+	return text, scanner.Err()
+}
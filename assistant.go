@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// how often a run is checked on while the assistant works
+const runPollInterval = 500 * time.Millisecond
+
+// the files from --attach, uploaded with the first message of the run
+var attachmentIDs []string
+var attachmentsSent bool
+
+// threadsFile maps assistant ids to the thread last used with each
+func threadsFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chatgpt", "threads.json"), nil
+}
+
+func loadThreads() (map[string]string, error) {
+	threads := map[string]string{}
+	filename, err := threadsFile()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return threads, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &threads)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filename, err)
+	}
+	return threads, nil
+}
+
+func saveThread(assistant, thread string) error {
+	threads, err := loadThreads()
+	if err != nil {
+		return err
+	}
+	threads[assistant] = thread
+	filename, _ := threadsFile()
+	b, err := json.MarshalIndent(threads, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0644)
+}
+
+// AssistantThread returns the --thread, or the thread last used with the assistant,
+// creating and remembering a new one when there is none or --new-thread is set
+func AssistantThread(client *gpt3.Client, ctx context.Context) (string, error) {
+	if ThreadID != "" {
+		return ThreadID, nil
+	}
+	if !NewThread {
+		threads, err := loadThreads()
+		if err != nil {
+			return "", err
+		}
+		if id := threads[AssistantID]; id != "" {
+			ThreadID = id
+			return id, nil
+		}
+	}
+
+	thread, err := client.CreateThread(ctx, gpt3.ThreadRequest{})
+	if err != nil {
+		return "", err
+	}
+	ThreadID = thread.ID
+	Notef("started thread %s\n", thread.ID)
+	return thread.ID, saveThread(AssistantID, thread.ID)
+}
+
+// GetAssistantResponse adds the latest question to the assistant's thread and runs it.
+// The thread keeps the history, so earlier messages are not sent again
+func GetAssistantResponse(client *gpt3.Client, ctx context.Context, conv *Conversation) ([]string, error) {
+	thread, err := AssistantThread(client, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var question string
+	var instructions []string
+	for _, m := range conv.Messages {
+		switch m.Role {
+		case gpt3.ChatMessageRoleSystem:
+			instructions = append(instructions, m.Content)
+		case gpt3.ChatMessageRoleUser:
+			question = m.Content
+		}
+	}
+
+	msg := gpt3.MessageRequest{Role: gpt3.ChatMessageRoleUser, Content: question}
+	if !attachmentsSent {
+		for _, f := range Attachments {
+			id, err := uploadAttachment(client, ctx, f)
+			if err != nil {
+				return nil, err
+			}
+			attachmentIDs = append(attachmentIDs, id)
+		}
+		for _, id := range attachmentIDs {
+			msg.Attachments = append(msg.Attachments, gpt3.ThreadAttachment{
+				FileID: id,
+				Tools:  []gpt3.ThreadAttachmentTool{{Type: string(gpt3.AssistantToolTypeCodeInterpreter)}},
+			})
+		}
+		attachmentsSent = true
+	}
+	_, err = client.CreateMessage(ctx, thread, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	req := gpt3.RunRequest{
+		AssistantID:            AssistantID,
+		AdditionalInstructions: strings.Join(instructions, "\n"),
+	}
+	if CodeInterpreter || len(attachmentIDs) > 0 {
+		req.Tools = []gpt3.Tool{{Type: gpt3.ToolType(gpt3.AssistantToolTypeCodeInterpreter)}}
+	}
+	run, err := client.CreateRun(ctx, thread, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// a run left going keeps the thread busy, and is billed, so it is cancelled when given up on
+	runID := run.ID
+	cancelRun := func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		client.CancelRun(ctx, thread, runID)
+	}
+	for run.Status == gpt3.RunStatusQueued || run.Status == gpt3.RunStatusInProgress || run.Status == gpt3.RunStatusCancelling {
+		select {
+		case <-ctx.Done():
+			cancelRun()
+			return nil, ctx.Err()
+		case <-time.After(runPollInterval):
+		}
+		run, err = client.RetrieveRun(ctx, thread, run.ID)
+		if err != nil {
+			if ctx.Err() != nil {
+				cancelRun()
+			}
+			return nil, err
+		}
+	}
+	LastUsage = run.Usage
+
+	switch run.Status {
+	case gpt3.RunStatusCompleted:
+	case gpt3.RunStatusRequiresAction:
+		cancelRun()
+		return nil, fmt.Errorf("the assistant called a function, only code interpreter is supported")
+	default:
+		if run.LastError != nil {
+			return nil, fmt.Errorf("assistant run %s: %s", run.Status, run.LastError.Message)
+		}
+		return nil, fmt.Errorf("assistant run %s", run.Status)
+	}
+
+	order := "asc"
+	messages, err := client.ListMessage(ctx, thread, nil, &order, nil, nil, &run.ID)
+	if err != nil {
+		return nil, err
+	}
+	var text []string
+	for _, m := range messages.Messages {
+		for _, c := range m.Content {
+			if c.Text != nil {
+				text = append(text, c.Text.Value)
+			}
+		}
+	}
+	return []string{strings.Join(text, "\n\n")}, nil
+}
+
+func uploadAttachment(client *gpt3.Client, ctx context.Context, filename string) (string, error) {
+	f, err := client.CreateFile(ctx, gpt3.FileRequest{
+		FileName: filepath.Base(filename),
+		FilePath: filename,
+		Purpose:  string(gpt3.PurposeAssistants),
+	})
+	if err != nil {
+		return "", err
+	}
+	Notef("uploaded %s as %s\n", filename, f.ID)
+	return f.ID, nil
+}
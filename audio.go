@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+var TranscribeTranslate bool
+var TranscribeLanguage string
+var TranscribeFormat string
+var TranscribeOutput string
+
+func NewTranscribeCmd(client *gpt3.Client) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "transcribe <audio file>",
+		Short: "turn a recording into text with Whisper, to use as context",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := Transcribe(client, context.Background(), args[0])
+			if err != nil {
+				PrintError(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVarP(&TranscribeTranslate, "translate", "", false, "translate the speech to English instead of transcribing it as spoken")
+	cmd.Flags().StringVarP(&TranscribeLanguage, "language", "l", "", "ISO-639-1 language of the speech, like 'en', detected when not set")
+	cmd.Flags().StringVarP(&TranscribeFormat, "format", "f", "txt", "output format: txt, srt, vtt, or json")
+	cmd.Flags().StringVarP(&TranscribeOutput, "output", "o", "", "write to this file instead of stdout")
+
+	return cmd
+}
+
+var transcribeFormats = map[string]gpt3.AudioResponseFormat{
+	"txt":  gpt3.AudioResponseFormatText,
+	"srt":  gpt3.AudioResponseFormatSRT,
+	"vtt":  gpt3.AudioResponseFormatVTT,
+	"json": gpt3.AudioResponseFormatVerboseJSON,
+}
+
+// Transcribe writes the text of the recording in TranscribeFormat
+func Transcribe(client *gpt3.Client, ctx context.Context, filename string) error {
+	format, ok := transcribeFormats[TranscribeFormat]
+	if !ok {
+		return fmt.Errorf("unknown --format %q, use txt, srt, vtt, or json", TranscribeFormat)
+	}
+
+	req := gpt3.AudioRequest{
+		Model:    gpt3.Whisper1,
+		FilePath: filename,
+		Format:   format,
+	}
+
+	var resp gpt3.AudioResponse
+	var err error
+	if TranscribeTranslate {
+		resp, err = client.CreateTranslation(ctx, req)
+	} else {
+		req.Language = TranscribeLanguage
+		resp, err = client.CreateTranscription(ctx, req)
+	}
+	if err != nil {
+		return err
+	}
+
+	text := resp.Text
+	if TranscribeFormat == "json" {
+		b, err := json.MarshalIndent(resp, "", "  ")
+		if err != nil {
+			return err
+		}
+		text = string(b) + "\n"
+	}
+
+	if TranscribeOutput == "" {
+		fmt.Print(text)
+		return nil
+	}
+	return os.WriteFile(TranscribeOutput, []byte(text), 0644)
+}
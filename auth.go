@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+// keys are stored under this service in the system keyring,
+// with the provider name as the account
+const keyringService = "chatgpt"
+
+// keyringAccount is where the key of a provider is kept,
+// azure and compatible servers share the openai key
+func keyringAccount(provider string) string {
+	if provider == "anthropic" || provider == "gemini" {
+		return provider
+	}
+	return "openai"
+}
+
+// keyringKey returns the stored key of the provider, or "" when there is none
+// or no keyring is available, as on a server without a Secret Service
+func keyringKey(provider string) string {
+	key, err := keyring.Get(keyringService, keyringAccount(provider))
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		Logger.Debug("keyring", "error", err)
+	}
+	return key
+}
+
+func NewAuthCmd(client *gpt3.Client) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "auth",
+		Short: "keep API keys in the system keyring, one for each --provider",
+		// the key is what is being changed
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			err := SetDefaults(cmd)
+			if err == nil {
+				err = ConfigureTransport()
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	login := &cobra.Command{
+		Use:   "login",
+		Short: "store the key of the --provider in the keyring, read from the terminal or stdin",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := AuthLogin(ProviderName)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	logout := &cobra.Command{
+		Use:   "logout",
+		Short: "remove the key of the --provider from the keyring",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := keyring.Delete(keyringService, keyringAccount(ProviderName))
+			if errors.Is(err, keyring.ErrNotFound) {
+				err = fmt.Errorf("no %s key in the keyring", keyringAccount(ProviderName))
+			} else if err != nil {
+				err = fmt.Errorf("removing the key from the keyring: %w", err)
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Printf("removed the %s key from the keyring\n", keyringAccount(ProviderName))
+		},
+	}
+
+	var keyFile string
+	var checkOld bool
+	rotate := &cobra.Command{
+		Use:   "rotate",
+		Short: "replace the key of the --provider where it is kept, once the API accepts the new one",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := AuthRotate(client, keyFile, checkOld)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+	rotate.Flags().StringVarP(&keyFile, "key-file", "", "", "read the new key from this file instead of the terminal or stdin")
+	rotate.Flags().BoolVarP(&checkOld, "check-old", "", false, "afterwards, check that the API refuses the old key, once it is revoked")
+
+	cmd.AddCommand(login, logout, rotate)
+	return cmd
+}
+
+// AuthLogin reads a key and stores it in the keyring
+func AuthLogin(provider string) error {
+	account := keyringAccount(provider)
+	key, err := readSecret(fmt.Sprintf("%s API key: ", account))
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return fmt.Errorf("no key given")
+	}
+
+	err = keyring.Set(keyringService, account, key)
+	if err != nil {
+		return fmt.Errorf("storing the key in the keyring: %w\nuse --api-key-file or %s instead", err, DefaultKeyFile())
+	}
+	fmt.Printf("stored the %s key in the keyring\n", account)
+	return nil
+}
+
+// AuthRotate validates a new key with the API, then stores it in place of the current one,
+// in the keyring or key file it was read from
+func AuthRotate(client *gpt3.Client, keyFile string, checkOld bool) error {
+	account := keyringAccount(ProviderName)
+	store, old, err := currentKey(account)
+	if err != nil {
+		return err
+	}
+
+	var key string
+	if keyFile != "" {
+		keys, err := readKeyFile(keyFile)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 1 {
+			return fmt.Errorf("%s has %d keys, give a file with just the new one", keyFile, len(keys))
+		}
+		key = keys[0]
+	} else {
+		key, err = readSecret(fmt.Sprintf("new %s API key: ", account))
+		if err != nil {
+			return err
+		}
+	}
+	if key == "" {
+		return fmt.Errorf("no key given")
+	}
+	if key == old {
+		return fmt.Errorf("the new key is the same as the current one")
+	}
+
+	err = checkKey(client, key)
+	if err != nil {
+		return fmt.Errorf("the new key did not work, nothing was changed: %w", err)
+	}
+
+	if store == "keyring" {
+		err = keyring.Set(keyringService, account, key)
+	} else {
+		err = writeKeyFile(store, key)
+	}
+	if err != nil {
+		return fmt.Errorf("storing the new key in %s: %w", store, err)
+	}
+	fmt.Printf("replaced the %s key in %s\n", account, store)
+
+	if !checkOld {
+		return nil
+	}
+	err = checkKey(client, old)
+	var apiErr *gpt3.APIError
+	switch {
+	case err == nil:
+		fmt.Fprintln(os.Stderr, "warning: the old key still works, revoke it with your provider")
+	case errors.As(err, &apiErr) && (apiErr.HTTPStatusCode == http.StatusUnauthorized || apiErr.HTTPStatusCode == http.StatusForbidden):
+		fmt.Println("the old key is refused")
+	default:
+		fmt.Fprintf(os.Stderr, "warning: could not check the old key: %v\n", err)
+	}
+	return nil
+}
+
+// currentKey finds where the key of the account is kept, the keyring or
+// a key file, keys in environment variables have to be changed where they are set
+func currentKey(account string) (store, key string, err error) {
+	envs := []string{"CHATGPT_API_KEY", "OPENAI_API_KEY"}
+	switch account {
+	case "anthropic":
+		envs = []string{"ANTHROPIC_API_KEY"}
+	case "gemini":
+		envs = []string{"GEMINI_API_KEY"}
+	}
+
+	filename := APIKeyFile
+	if account == "openai" && filename == "" {
+		for _, env := range envs {
+			if os.Getenv(env) != "" {
+				return "", "", fmt.Errorf("the key is in $%s, change it where that is set", env)
+			}
+		}
+		if key := keyringKey(account); key != "" {
+			return "keyring", key, nil
+		}
+		filename = DefaultKeyFile()
+		if _, err := os.Stat(filename); err != nil {
+			filename = ""
+		}
+	}
+	if account == "openai" && filename != "" {
+		keys, err := readKeyFile(filename)
+		if err != nil {
+			return "", "", err
+		}
+		if len(keys) > 1 {
+			return "", "", fmt.Errorf("%s has %d keys, edit it to replace one", filename, len(keys))
+		}
+		return filename, keys[0], nil
+	}
+
+	if account != "openai" && os.Getenv(envs[0]) != "" {
+		return "", "", fmt.Errorf("the key is in $%s, change it where that is set", envs[0])
+	}
+	if key := keyringKey(account); key != "" {
+		return "keyring", key, nil
+	}
+	return "", "", fmt.Errorf("no %s key to replace, store one with 'chatgpt auth login'", account)
+}
+
+// checkKey makes a request that needs a valid key, listing the models of the --provider
+func checkKey(client *gpt3.Client, key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var url string
+	header := http.Header{}
+	switch ProviderName {
+	case "anthropic":
+		url = defaultAnthropicURL
+		header.Set("x-api-key", key)
+		header.Set("anthropic-version", anthropicVersion)
+	case "gemini":
+		url = defaultGeminiURL
+		header.Set("x-goog-api-key", key)
+	default:
+		clientKey, apiKeys = key, nil
+		err := ConfigureClient(client)
+		if err == nil {
+			_, err = client.ListModels(ctx)
+		}
+		return err
+	}
+	if APIBase != "" {
+		url = strings.TrimRight(APIBase, "/")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/models", nil)
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	resp, err := apiHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &gpt3.APIError{Message: strings.TrimSpace(string(b)), HTTPStatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// readSecret prompts for a line without echoing it on a terminal,
+// otherwise the first line of stdin is read, for 'pass show openai | chatgpt auth login'
+func readSecret(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("reading the key from stdin: %w", err)
+		}
+		return strings.TrimSpace(line), nil
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
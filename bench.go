@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+var BenchRequests int
+var BenchConcurrency int
+var BenchStream bool
+var BenchPrompt string
+var BenchModel string
+var BenchTokens int
+
+type benchResult struct {
+	latency time.Duration
+	ttft    time.Duration // time to first token, only when streaming
+	tokens  int
+	usage   gpt3.Usage
+	err     error
+}
+
+func NewBenchCmd(client *gpt3.Client) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "measure latency and throughput of the API endpoint",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := RunBench(client)
+			if err != nil {
+				PrintError(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().IntVarP(&BenchRequests, "requests", "n", 10, "number of requests to send")
+	cmd.Flags().IntVarP(&BenchConcurrency, "concurrency", "j", 1, "number of requests in flight at once")
+	cmd.Flags().BoolVarP(&BenchStream, "stream", "s", false, "stream responses and measure time to first token")
+	cmd.Flags().StringVarP(&BenchPrompt, "prompt", "p", "Say hello.", "prompt to send with every request")
+	// separate from the root flags, whose defaults would otherwise be overwritten
+	cmd.Flags().IntVarP(&BenchTokens, "tokens", "T", 16, "set the MaxTokens to generate per response")
+	cmd.Flags().StringVarP(&BenchModel, "model", "m", gpt3.GPT3TextDavinci003, "select the model to benchmark")
+
+	return cmd
+}
+
+func RunBench(client *gpt3.Client) error {
+	if BenchRequests < 1 || BenchConcurrency < 1 {
+		return fmt.Errorf("requests and concurrency must be at least 1")
+	}
+	// bench sends completions with the client
+	if ProviderName != "openai" && ProviderName != "azure" {
+		return fmt.Errorf("bench needs --provider openai or azure, not %s", ProviderName)
+	}
+	err := CheckBudget()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	req := gpt3.CompletionRequest{
+		Model:     BenchModel,
+		MaxTokens: BenchTokens,
+		Prompt:    BenchPrompt,
+	}
+
+	jobs := make(chan struct{})
+	results := make(chan benchResult, BenchRequests)
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for w := 0; w < BenchConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				if BenchStream {
+					results <- benchStream(client, ctx, req)
+				} else {
+					results <- benchOnce(client, ctx, req)
+				}
+			}
+		}()
+	}
+	for i := 0; i < BenchRequests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+	wg.Wait()
+	close(results)
+	elapsed := time.Since(start)
+
+	var latencies, ttfts []time.Duration
+	tokens, errs := 0, 0
+	var lastErr error
+	var usage gpt3.Usage
+	for r := range results {
+		if r.err != nil {
+			errs++
+			lastErr = r.err
+			continue
+		}
+		usage.PromptTokens += r.usage.PromptTokens
+		usage.CompletionTokens += r.usage.CompletionTokens
+		usage.TotalTokens += r.usage.TotalTokens
+		latencies = append(latencies, r.latency)
+		ttfts = append(ttfts, r.ttft)
+		tokens += r.tokens
+	}
+	RecordSpend(BenchModel, usage)
+
+	fmt.Printf("model:       %s\n", BenchModel)
+	fmt.Printf("requests:    %d (concurrency %d, stream %v)\n", BenchRequests, BenchConcurrency, BenchStream)
+	fmt.Printf("errors:      %d (%.1f%%)\n", errs, 100*float64(errs)/float64(BenchRequests))
+	if lastErr != nil {
+		fmt.Printf("last error:  %v\n", lastErr)
+	}
+	if len(latencies) == 0 {
+		return nil
+	}
+	fmt.Printf("latency:     %s\n", percentiles(latencies))
+	if BenchStream {
+		fmt.Printf("first token: %s\n", percentiles(ttfts))
+	}
+	fmt.Printf("throughput:  %.1f tokens/sec, %.2f requests/sec\n",
+		float64(tokens)/elapsed.Seconds(), float64(len(latencies))/elapsed.Seconds())
+	return nil
+}
+
+func benchOnce(client *gpt3.Client, ctx context.Context, req gpt3.CompletionRequest) benchResult {
+	start := time.Now()
+	resp, err := client.CreateCompletion(ctx, req)
+	if err != nil {
+		return benchResult{err: err}
+	}
+	latency := time.Since(start)
+	r := benchResult{latency: latency, ttft: latency}
+	if resp.Usage != nil {
+		r.tokens, r.usage = resp.Usage.CompletionTokens, *resp.Usage
+	}
+	return r
+}
+
+func benchStream(client *gpt3.Client, ctx context.Context, req gpt3.CompletionRequest) benchResult {
+	start := time.Now()
+	stream, err := client.CreateCompletionStream(ctx, req)
+	if err != nil {
+		return benchResult{err: err}
+	}
+	defer stream.Close()
+
+	var r benchResult
+	for {
+		_, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return benchResult{err: err}
+		}
+		// the stream carries no usage, each event is about one token
+		if r.tokens == 0 {
+			r.ttft = time.Since(start)
+		}
+		r.tokens++
+	}
+	r.latency = time.Since(start)
+	r.usage.PromptTokens = EstimateTokens(BenchPrompt)
+	r.usage.CompletionTokens = r.tokens
+	r.usage.TotalTokens = r.usage.PromptTokens + r.tokens
+	return r
+}
+
+// percentiles formats the p50, p95, and p99 of ds
+func percentiles(ds []time.Duration) string {
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	p := func(q float64) time.Duration {
+		return ds[int(q*float64(len(ds)-1))]
+	}
+	return fmt.Sprintf("p50 %v  p95 %v  p99 %v", p(0.50).Round(time.Millisecond), p(0.95).Round(time.Millisecond), p(0.99).Round(time.Millisecond))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// BudgetDaily and BudgetMonthly are the --budget-daily and --budget-monthly in USD, 0 is no budget
+var BudgetDaily float64
+var BudgetMonthly float64
+
+// Force is the --force, to go on with a spent budget
+var Force bool
+
+// warn at this share of a budget
+const budgetWarnAt = 0.8
+
+// spendMu keeps concurrent requests from losing each other's costs
+var spendMu sync.Mutex
+
+// SpendFile keeps the estimated cost of each day
+func SpendFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "chatgpt", "spend.json")
+}
+
+// loadSpend reads the cost of each day, as YYYY-MM-DD to USD
+func loadSpend() (map[string]float64, error) {
+	spend := map[string]float64{}
+	b, err := os.ReadFile(SpendFile())
+	if os.IsNotExist(err) {
+		return spend, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &spend)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", SpendFile(), err)
+	}
+	return spend, nil
+}
+
+// spent totals the cost of today and of this month
+func spent(spend map[string]float64, now time.Time) (day, month float64) {
+	today := now.Format("2006-01-02")
+	for d, cost := range spend {
+		if strings.HasPrefix(d, today[:8]) {
+			month += cost
+		}
+	}
+	return spend[today], month
+}
+
+// CheckBudget refuses a request once a budget is spent, unless --force is given,
+// and warns when one is nearly spent
+func CheckBudget() error {
+	if BudgetDaily <= 0 && BudgetMonthly <= 0 {
+		return nil
+	}
+	spendMu.Lock()
+	spend, err := loadSpend()
+	spendMu.Unlock()
+	if err != nil {
+		return err
+	}
+	day, month := spent(spend, time.Now())
+
+	for _, b := range []struct {
+		name          string
+		spent, budget float64
+	}{
+		{"daily", day, BudgetDaily},
+		{"monthly", month, BudgetMonthly},
+	} {
+		if b.budget <= 0 {
+			continue
+		}
+		if b.spent >= b.budget {
+			if !Force {
+				return fmt.Errorf("the %s budget of $%.2f is spent, an estimated $%.2f, raise --budget-%s or give --force", b.name, b.budget, b.spent, b.name)
+			}
+			fmt.Fprintf(os.Stderr, "warning: the %s budget of $%.2f is spent, an estimated $%.2f, going on with --force\n", b.name, b.budget, b.spent)
+		} else if b.spent >= b.budget*budgetWarnAt {
+			fmt.Fprintf(os.Stderr, "warning: an estimated $%.2f of the %s budget of $%.2f is spent\n", b.spent, b.name, b.budget)
+		}
+	}
+	return nil
+}
+
+// RecordSpend adds the estimated cost of usage by model to today,
+// models without a known price are not counted
+func RecordSpend(model string, usage gpt3.Usage) {
+	cost, ok := EstimateCost(model, usage)
+	if !ok {
+		warnUnpriced(model)
+		return
+	}
+	RecordCost(cost)
+}
+
+// the models warned about by warnUnpriced
+var unpriced = map[string]bool{}
+
+// warnUnpriced warns once for each model whose cost cannot be estimated,
+// when a budget is set, as the budget then does not hold
+func warnUnpriced(model string) {
+	Logger.Debug("unknown price, cost not recorded", "model", model)
+	if BudgetDaily <= 0 && BudgetMonthly <= 0 {
+		return
+	}
+	spendMu.Lock()
+	defer spendMu.Unlock()
+	if unpriced[model] {
+		return
+	}
+	unpriced[model] = true
+	fmt.Fprintf(os.Stderr, "warning: the price of %s is not known, its cost is not counted against the budget\n", model)
+}
+
+// RecordCost adds cost in USD to today, for what is not priced by the token
+func RecordCost(cost float64) {
+	if cost <= 0 {
+		return
+	}
+	spendMu.Lock()
+	defer spendMu.Unlock()
+	spend, err := loadSpend()
+	if err != nil {
+		Logger.Warn("recording spend", "error", err.Error())
+		return
+	}
+	now := time.Now()
+	spend[now.Format("2006-01-02")] += cost
+	// only this month and the last are needed
+	for d := range spend {
+		if t, err := time.Parse("2006-01-02", d); err != nil || now.Sub(t) > 62*24*time.Hour {
+			delete(spend, d)
+		}
+	}
+
+	b, err := json.MarshalIndent(spend, "", "  ")
+	if err == nil {
+		os.MkdirAll(filepath.Dir(SpendFile()), 0755)
+		err = os.WriteFile(SpendFile(), b, 0644)
+	}
+	if err != nil {
+		Logger.Warn("recording spend", "error", err.Error())
+	}
+}
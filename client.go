@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// the transport under every API request, set up by ConfigureTransport once flags are parsed
+var apiTransport = http.DefaultTransport.(*http.Transport).Clone()
+var apiHTTPClient *http.Client
+var apiBaseURL string
+var clientKey string // set by LoadAPIKey
+var extraHeaders http.Header
+
+// the default api version for azure, the first with tools and json mode
+const defaultAzureAPIVersion = "2024-06-01"
+
+// NewClient creates the API client, with a transport
+// that applies the connection flags to every request
+func NewClient() *gpt3.Client {
+	config := gpt3.DefaultConfig("")
+	apiHTTPClient = &http.Client{
+		Transport: &retryTransport{base: &authTransport{base: &timeoutTransport{base: apiTransport}}},
+	}
+	config.HTTPClient = apiHTTPClient
+	apiBaseURL = config.BaseURL
+	return gpt3.NewClientWithConfig(config)
+}
+
+// ConfigureClient sets up the --provider and the --fallback providers, it runs before every
+// command once flags are parsed, so the subcommands use the provider too
+func ConfigureClient(client *gpt3.Client) error {
+	if APIBase == "" {
+		APIBase = os.Getenv("CHATGPT_API_BASE")
+	}
+	var err error
+	ChatProvider, err = NewProvider(ProviderName, APIBase, client)
+	if err != nil {
+		return err
+	}
+
+	fallbacks = nil
+	for _, f := range Fallbacks {
+		name, model, _ := strings.Cut(f, ":")
+		if model == "" {
+			return fmt.Errorf("--fallback %q: expected provider:model, like anthropic:claude-3-5-haiku-latest", f)
+		}
+		p, err := NewProvider(name, "", nil)
+		if err != nil {
+			return fmt.Errorf("--fallback %q: %w", f, err)
+		}
+		fallbacks = append(fallbacks, fallback{name, ResolveModel(model), p})
+	}
+	return nil
+}
+
+// openaiConfig is the client config for the openai and azure providers,
+// base is another OpenAI-compatible server to use instead
+func openaiConfig(name, base string) (gpt3.ClientConfig, error) {
+	// local servers usually take any key, or none
+	if clientKey == "" && (name == "azure" || base == "") {
+		return gpt3.ClientConfig{}, errNoKey()
+	}
+
+	config := gpt3.DefaultConfig(clientKey)
+	if name == "azure" {
+		endpoint := AzureEndpoint
+		if endpoint == "" {
+			endpoint = os.Getenv("AZURE_OPENAI_ENDPOINT")
+		}
+		if endpoint == "" {
+			return config, fmt.Errorf("--provider azure needs --azure-endpoint or AZURE_OPENAI_ENDPOINT")
+		}
+		config = gpt3.DefaultAzureConfig(clientKey, strings.TrimRight(endpoint, "/"))
+		config.APIVersion = AzureAPIVersion
+		// without a deployment, each model is expected to be deployed under its own name
+		if AzureDeployment != "" {
+			config.AzureModelMapperFunc = func(string) string { return AzureDeployment }
+		}
+	} else if base != "" {
+		config.BaseURL = strings.TrimRight(base, "/")
+	}
+	config.HTTPClient = apiHTTPClient
+	return config, nil
+}
+
+// ConfigureTransport applies the connection flags to the transport
+func ConfigureTransport() error {
+	if KeepAlive > 0 {
+		apiTransport.IdleConnTimeout = KeepAlive
+	}
+	apiTransport.MaxIdleConnsPerHost = 4
+
+	// Go only reads HTTPS_PROXY and HTTP_PROXY, curl and others also use ALL_PROXY
+	all := os.Getenv("ALL_PROXY")
+	if all == "" {
+		all = os.Getenv("all_proxy")
+	}
+	for _, env := range []string{"HTTPS_PROXY", "HTTP_PROXY"} {
+		if all != "" && os.Getenv(env) == "" && os.Getenv(strings.ToLower(env)) == "" {
+			os.Setenv(env, all)
+		}
+	}
+
+	if Proxy != "" {
+		u, err := parseProxy(Proxy)
+		if err != nil {
+			return err
+		}
+		apiTransport.Proxy = http.ProxyURL(u)
+	}
+
+	tlsConfig, err := loadTLSConfig()
+	if err != nil {
+		return err
+	}
+	apiTransport.TLSClientConfig = tlsConfig
+
+	extraHeaders, err = parseHeaders(Headers)
+	return err
+}
+
+// loadTLSConfig adds the --ca-cert to the system roots, and presents the --client-cert
+func loadTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{}
+	if CACert != "" {
+		b, err := os.ReadFile(CACert)
+		if err != nil {
+			return nil, fmt.Errorf("--ca-cert: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("--ca-cert %s: no PEM certificates found", CACert)
+		}
+		config.RootCAs = pool
+	}
+
+	if ClientKey != "" && ClientCert == "" {
+		return nil, fmt.Errorf("--client-key needs --client-cert")
+	}
+	if ClientCert != "" {
+		// the key is often in the same file as the certificate
+		key := ClientKey
+		if key == "" {
+			key = ClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(ClientCert, key)
+		if err != nil {
+			return nil, fmt.Errorf("--client-cert: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if Insecure {
+		fmt.Fprintln(os.Stderr, "warning: --insecure, TLS certificates are not verified, the API key can be read by anyone between you and the API")
+		config.InsecureSkipVerify = true
+	}
+	return config, nil
+}
+
+// parseHeaders reads the 'Name: value' of each --header
+func parseHeaders(headers []string) (http.Header, error) {
+	h := http.Header{}
+	for _, s := range headers {
+		name, value, ok := strings.Cut(s, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("--header %q: expected 'Name: value'", s)
+		}
+		h.Add(name, strings.TrimSpace(value))
+	}
+	return h, nil
+}
+
+// parseProxy reads a proxy URL, a bare host:port is an HTTP proxy
+func parseProxy(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("--proxy: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported --proxy scheme %q, use http, https, or socks5", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("--proxy %q has no host", s)
+	}
+	return u, nil
+}
+
+// Warmup opens a connection to the API in the background, so the first
+// request of a session does not wait on DNS, TCP, and TLS setup.
+// The request is unauthenticated, it only has to leave an idle connection behind
+func Warmup() {
+	go func() {
+		resp, err := apiHTTPClient.Get(apiBaseURL + "/models")
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
+
+// GetAPI decodes the JSON from a GET of an API path, for endpoints the client does not cover
+func GetAPI(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiBaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	if ProviderName == "azure" {
+		req.Header.Set("api-key", clientKey)
+		q := req.URL.Query()
+		q.Set("api-version", AzureAPIVersion)
+		req.URL.RawQuery = q.Encode()
+	} else {
+		req.Header.Set("Authorization", "Bearer "+clientKey)
+	}
+	resp, err := apiHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("status code: %d, %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// timeoutTransport ends each request after the --timeout, reading the response included
+type timeoutTransport struct {
+	base http.RoundTripper
+}
+
+// errTimeout is returned when a request runs past the --timeout
+type errTimeout struct {
+	d time.Duration
+}
+
+func (e errTimeout) Error() string { return fmt.Sprintf("request timed out after %s", e.d) }
+func (e errTimeout) Timeout() bool { return true }
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if Timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), Timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, timeoutErr(ctx, err)
+	}
+	resp.Body = &timeoutBody{ReadCloser: resp.Body, ctx: ctx, cancel: cancel}
+	return resp, nil
+}
+
+// timeoutBody keeps the deadline while a response is read, streams end with it too
+type timeoutBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = timeoutErr(b.ctx, err)
+	}
+	return n, err
+}
+
+func (b *timeoutBody) Close() error {
+	b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// timeoutErr replaces the error of a request that ran out of time
+func timeoutErr(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errTimeout{Timeout}
+	}
+	return err
+}
+
+// authTransport moves the API key to where a gateway expects it,
+// the client always sends it as 'Authorization: Bearer <key>'.
+// With several keys, it picks the key of each request by --key-rotation
+type authTransport struct {
+	base http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(extraHeaders) > 0 || (ProviderName == "openai" && (OrgID != "" || ProjectID != "")) {
+		req = req.Clone(req.Context())
+		for name, values := range extraHeaders {
+			req.Header[name] = values
+		}
+		if ProviderName == "openai" && OrgID != "" {
+			req.Header.Set("OpenAI-Organization", OrgID)
+		}
+		if ProviderName == "openai" && ProjectID != "" {
+			req.Header.Set("OpenAI-Project", ProjectID)
+		}
+	}
+
+	// the other providers send their own key headers
+	if len(apiKeys) < 2 || (ProviderName != "openai" && ProviderName != "azure") {
+		return t.send(req, clientKey)
+	}
+
+	key := requestKey()
+	resp, err := t.send(req, key)
+	// a rate limited request is sent again with each of the other keys
+	for i := 1; i < len(apiKeys) && err == nil && resp.StatusCode == http.StatusTooManyRequests; i++ {
+		if req.Body != nil && req.GetBody == nil {
+			break
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		key = rotateKey()
+		Logger.Info("key rotated", "key", RedactKey(key))
+		retry := req.Clone(req.Context())
+		if req.GetBody != nil {
+			retry.Body, err = req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+		resp, err = t.send(retry, key)
+	}
+	return resp, err
+}
+
+// send applies the key to the request
+func (t *authTransport) send(req *http.Request, key string) (*http.Response, error) {
+	if key == "" {
+		req = req.Clone(req.Context())
+		req.Header.Del("Authorization")
+		return t.base.RoundTrip(req)
+	}
+	if key == clientKey && AuthHeader == "Authorization" && AuthScheme == "Bearer" && AuthQuery == "" {
+		return t.base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the original request
+	req = req.Clone(req.Context())
+	if req.Header.Get("api-key") != "" {
+		// azure sends the key in its own header
+		req.Header.Set("api-key", key)
+		if AuthHeader == "Authorization" && AuthScheme == "Bearer" && AuthQuery == "" {
+			return t.base.RoundTrip(req)
+		}
+	}
+	req.Header.Del("Authorization")
+
+	if AuthQuery != "" {
+		q := req.URL.Query()
+		q.Set(AuthQuery, key)
+		req.URL.RawQuery = q.Encode()
+	} else {
+		value := key
+		if AuthScheme != "" {
+			value = AuthScheme + " " + key
+		}
+		req.Header.Set(AuthHeader, value)
+	}
+
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// ModelFamily groups models by the parameters they accept
+func ModelFamily(model string) string {
+	// fine-tuned models are named ft:<base model>:...
+	model = strings.TrimPrefix(model, "ft:")
+	switch {
+	case strings.HasPrefix(model, "o1"), strings.HasPrefix(model, "o3"), strings.HasPrefix(model, "o4"),
+		strings.HasPrefix(model, "gpt-5"):
+		return "reasoning"
+	case strings.HasSuffix(model, "-instruct"):
+		// gpt-3.5-turbo-instruct takes prompts
+		return "completion"
+	case strings.HasPrefix(model, "gpt-3.5-turbo"), strings.HasPrefix(model, "gpt-4"), strings.HasPrefix(model, "chatgpt-"),
+		strings.HasPrefix(model, "claude"), strings.HasPrefix(model, "gemini"):
+		return "chat"
+	case strings.Contains(model, "-edit-"):
+		return "edit"
+	case strings.Contains(model, "embedding"):
+		return "embedding"
+	case strings.HasPrefix(model, "whisper"), strings.HasPrefix(model, "tts"),
+		strings.HasPrefix(model, "dall-e"), strings.Contains(model, "moderation"):
+		// audio, image, and moderation models have their own endpoints
+		return "other"
+	case strings.HasPrefix(model, "text-"), strings.HasPrefix(model, "code-"), strings.HasPrefix(model, "davinci"),
+		strings.HasPrefix(model, "curie"), strings.HasPrefix(model, "babbage"), strings.HasPrefix(model, "ada"):
+		// the legacy models, only they take prompts
+		return "completion"
+	}
+	// newer models, and those of other servers, which name them freely, serve chat
+	return "chat"
+}
+
+// ValidateModel checks that the model can be used in the selected mode
+func ValidateModel(model string) error {
+	if model == "" {
+		return fmt.Errorf("no model selected, set one with --model")
+	}
+	if ProviderName == "anthropic" && (CodeMode || !strings.HasPrefix(model, "claude")) {
+		return fmt.Errorf("--provider anthropic needs a claude model, like claude-3-5-sonnet-latest")
+	}
+	if ProviderName == "gemini" && (CodeMode || !strings.HasPrefix(model, "gemini")) {
+		return fmt.Errorf("--provider gemini needs a gemini model, like gemini-1.5-flash")
+	}
+	if CodeMode {
+		// code mode always uses the codex model
+		return nil
+	}
+	family := ModelFamily(model)
+	if EditMode && family != "edit" && family != "chat" && family != "reasoning" {
+		return fmt.Errorf("%s is a %s model, -e needs a chat or edit model", model, family)
+	}
+	if !EditMode && family == "edit" {
+		return fmt.Errorf("%s is an edit model, use it with -e", model)
+	}
+	if family == "embedding" || family == "other" {
+		return fmt.Errorf("%s cannot answer questions, see 'chatgpt models' for chat and completion models", model)
+	}
+	return nil
+}
+
+// CheckRanges rejects sampling parameters the API would refuse
+func CheckRanges() error {
+	if ProviderName == "anthropic" && Temp > 1 {
+		return fmt.Errorf("--temp %g is out of range [0.0,1.0] for anthropic", Temp)
+	}
+	if Temp < 0 || Temp > 2 {
+		return fmt.Errorf("--temp %g is out of range [0.0,2.0]", Temp)
+	}
+	if TopP < 0 || TopP > 1 {
+		return fmt.Errorf("--topp %g is out of range [0.0,1.0]", TopP)
+	}
+	if PresencePenalty < -2 || PresencePenalty > 2 {
+		return fmt.Errorf("--pres %g is out of range [-2.0,2.0]", PresencePenalty)
+	}
+	if FrequencyPenalty < -2 || FrequencyPenalty > 2 {
+		return fmt.Errorf("--freq %g is out of range [-2.0,2.0]", FrequencyPenalty)
+	}
+	if BestOf != 0 && BestOf < Count {
+		return fmt.Errorf("--best-of %d must be at least --count %d", BestOf, Count)
+	}
+	// chat models return up to 20 alternatives, completion models up to 5
+	maxLogprobs := 20
+	if !Chatting() {
+		maxLogprobs = 5
+	}
+	if Logprobs < 0 || Logprobs > maxLogprobs {
+		return fmt.Errorf("--logprobs %d is out of range [0,%d] for %s", Logprobs, maxLogprobs, Model)
+	}
+	return nil
+}
+
+// ParseStops expands the escapes in --stop sequences,
+// the API accepts at most 4
+func ParseStops(stops []string) ([]string, error) {
+	if len(stops) > 4 {
+		return nil, fmt.Errorf("--stop was given %d times, at most 4 sequences are allowed", len(stops))
+	}
+	var r []string
+	for _, s := range stops {
+		u, err := strconv.Unquote(`"` + strings.ReplaceAll(s, `"`, `\"`) + `"`)
+		if err != nil {
+			return nil, fmt.Errorf("--stop %q: %w", s, err)
+		}
+		if u == "" {
+			return nil, fmt.Errorf("--stop sequences cannot be empty")
+		}
+		r = append(r, u)
+	}
+	return r, nil
+}
+
+// ParseLogitBias reads 'token:weight' pairs into the API's map of token ids.
+// No tokenizer is bundled, so tokens are given as ids, which are checked against
+// the size of the model's vocabulary, to catch ids looked up for another tokenizer
+func ParseLogitBias(pairs []string, model string) (map[string]int, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	encoding, size := modelEncoding(model)
+	bias := map[string]int{}
+	for _, p := range pairs {
+		token, weight, ok := strings.Cut(p, ":")
+		if !ok {
+			return nil, fmt.Errorf("--logit-bias %q: expected token:weight", p)
+		}
+		id, err := strconv.Atoi(token)
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("--logit-bias %q: %q is not a token id, words are not tokenized, look their ids up with https://platform.openai.com/tokenizer", p, token)
+		}
+		if size > 0 && id >= size {
+			return nil, fmt.Errorf("--logit-bias %q: %s has no token %d, its %s tokenizer has %d tokens, was the id looked up for another model?", p, model, id, encoding, size)
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil {
+			return nil, fmt.Errorf("--logit-bias %q: %w", p, err)
+		}
+		if w < -100 || w > 100 {
+			return nil, fmt.Errorf("--logit-bias %q: weight is out of range [-100,100]", p)
+		}
+		bias[token] = w
+	}
+	return bias, nil
+}
+
+// modelEncoding names the tokenizer of an OpenAI model and the number of its
+// token ids, special tokens included, size is 0 for models it is not known for
+func modelEncoding(model string) (string, int) {
+	model = strings.TrimPrefix(model, "ft:")
+	switch {
+	case strings.HasPrefix(model, "gpt-4o"), strings.HasPrefix(model, "gpt-4.1"), strings.HasPrefix(model, "gpt-4.5"),
+		strings.HasPrefix(model, "chatgpt-4o"), ModelFamily(model) == "reasoning":
+		return "o200k_base", 200019
+	case strings.HasPrefix(model, "gpt-4"), strings.HasPrefix(model, "gpt-3.5-turbo"),
+		strings.HasPrefix(model, "davinci-002"), strings.HasPrefix(model, "babbage-002"),
+		strings.HasPrefix(model, "text-embedding-"):
+		return "cl100k_base", 100277
+	case strings.HasPrefix(model, "text-davinci-"), strings.HasPrefix(model, "code-"):
+		return "p50k_base", 50281
+	}
+	return "", 0
+}
+
+// flags naming parameters each family rejects
+var unsupportedParams = map[string][]string{
+	"completion": {"tools", "tools-file", "image"},
+	"chat":       {"echo", "suffix", "suffix-file", "best-of"},
+	"reasoning":  {"echo", "temp", "topp", "pres", "freq", "stop", "logprobs", "logit-bias", "suffix", "suffix-file", "best-of"},
+	"edit":       {"echo", "pres", "freq", "tokens", "stop", "logprobs", "logit-bias", "suffix", "suffix-file", "best-of", "tools", "tools-file", "image"},
+}
+
+// flags naming parameters each provider rejects, on top of those of the family
+var unsupportedProviderParams = map[string][]string{
+	"anthropic": {"pres", "freq", "logprobs", "logit-bias", "seed", "json-output", "tools", "tools-file", "moderate", "assistant"},
+	"gemini":    {"logprobs", "logit-bias", "tools", "tools-file", "moderate", "assistant"},
+}
+
+// CheckParams drops parameters set on the command line that the model does not accept,
+// with a warning, or fails when --strict-params is set
+func CheckParams(flags *pflag.FlagSet) error {
+	model := Model
+	if CodeMode {
+		// code mode always uses the codex model
+		return nil
+	}
+	family := ModelFamily(model)
+
+	unsupported := unsupportedParams[family]
+	if names := unsupportedProviderParams[ProviderName]; len(names) > 0 {
+		unsupported = append(append([]string(nil), unsupported...), names...)
+		family = ProviderName
+	}
+	for _, name := range unsupported {
+		f := flags.Lookup(name)
+		if f == nil || !f.Changed {
+			continue
+		}
+		if StrictParams {
+			return fmt.Errorf("--%s is not supported by %s models like %s", name, family, model)
+		}
+		fmt.Fprintf(os.Stderr, "warning: dropping --%s, it is not supported by %s models like %s\n", name, family, model)
+		// zero values are left out of requests
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			sv.Replace(nil)
+		} else {
+			f.Value.Set(zeroValue(f))
+		}
+	}
+	return nil
+}
+
+func zeroValue(f *pflag.Flag) string {
+	switch f.Value.Type() {
+	case "bool":
+		return "false"
+	case "string":
+		return ""
+	}
+	return "0"
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestParseLogitBias(t *testing.T) {
+	for _, tt := range []struct {
+		pair  string
+		model string
+		ok    bool
+	}{
+		{"19701:-100", "gpt-4o", true},
+		{"150000:-100", "gpt-4o", true},
+		{"150000:-100", "gpt-4", false},
+		{"60000:5", "text-davinci-003", false},
+		{"150000:5", "my-local-model", true},
+		{"Sorry:-100", "gpt-4o", false},
+		{"-1:-100", "gpt-4o", false},
+		{"19701:-101", "gpt-4o", false},
+		{"19701", "gpt-4o", false},
+	} {
+		_, err := ParseLogitBias([]string{tt.pair}, tt.model)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s with %s: got %v, want ok %v", tt.pair, tt.model, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,754 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile is the --config, settings in it are used for flags that are not given
+var ConfigFile string
+
+// Profile is the --profile, a named set of settings in the config file,
+// used over the other settings of the file and the environment
+var Profile string
+
+// the per-project config, found in the working directory or a parent
+const projectConfigName = ".chatgpt.yaml"
+
+// settings a project may set, about what is asked and how. The others could send the key
+// or files elsewhere, run commands, or write files, so a cloned repository cannot set them,
+// they are only taken from the user's own config. parse-headers is left out, or the
+// project's own context files could set the others
+var projectAllowed = []string{
+	"prompt", "prompt-dir", "context", "context-separator", "no-context-separator", "line-numbers", "force-utf8",
+	"redact", "redact-rules", "suffix-file", "question-position", "prompt-format", "clean",
+	"model", "tokens", "count", "temp", "topp", "pres", "freq", "stop", "seed", "logit-bias", "logprobs", "strict-params",
+	"json-output", "until-json", "until-match", "max-retries", "request-retries", "no-stream", "max-lines", "separator",
+	"format", "fields", "json-pretty", "json-compact", "quiet", "no-auto-title", "max-turns",
+}
+
+// settings naming files, relative paths are from the directory of the config file
+var pathSettings = []string{"context", "prompt-dir", "redact-rules", "suffix-file", "ca-cert", "client-cert", "client-key"}
+
+// DefaultConfigFile is config.yaml in the chatgpt directory of the user config directory,
+// which is $XDG_CONFIG_HOME or ~/.config on Linux
+func DefaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "chatgpt", "config.yaml")
+}
+
+// LoadConfig reads a config file, a yaml map of long flag names to values,
+// lists are used for repeatable flags. A missing file has no settings
+func LoadConfig(filename string) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	if filename == "" {
+		return settings, nil
+	}
+	b, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(b, &settings)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", filename, err)
+	}
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+	return settings, nil
+}
+
+// SetConfigDefaults applies the settings to the flags that were not given,
+// unknown settings are errors when strict, so typos are not silently ignored.
+// The source is where the settings are from, for errors and --show-config
+func SetConfigDefaults(flags *pflag.FlagSet, settings map[string]interface{}, strict bool, source string) error {
+	var keys []string
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "profiles" || key == "aliases" {
+			continue
+		}
+		f := flags.Lookup(key)
+		if f == nil {
+			if strict {
+				return fmt.Errorf("%s: unknown setting %q, settings are long flag names", source, key)
+			}
+			continue
+		}
+		if f.Changed {
+			continue
+		}
+		err := setFlagValue(f, settings[key])
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", source, key, err)
+		}
+		SettingSources[f.Name] = source
+	}
+	return nil
+}
+
+// setFlagValue sets a flag from a yaml value, lists replace the values of repeatable flags
+func setFlagValue(f *pflag.Flag, value interface{}) error {
+	list, ok := value.([]interface{})
+	if !ok {
+		return f.Value.Set(fmt.Sprint(value))
+	}
+	sv, ok := f.Value.(pflag.SliceValue)
+	if !ok {
+		return fmt.Errorf("--%s takes a single value, not a list", f.Name)
+	}
+	var values []string
+	for _, v := range list {
+		values = append(values, fmt.Sprint(v))
+	}
+	return sv.Replace(values)
+}
+
+// FindProjectConfig returns the .chatgpt.yaml in the working directory
+// or the closest parent with one, or "" when there is none
+func FindProjectConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		filename := filepath.Join(dir, projectConfigName)
+		if _, err := os.Stat(filename); err == nil {
+			return filename
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// resolvePaths makes the file settings, and those of profiles, relative to dir
+func resolvePaths(settings map[string]interface{}, dir string) {
+	resolve := func(v interface{}) interface{} {
+		s := fmt.Sprint(v)
+		if s == "" || filepath.IsAbs(s) {
+			return s
+		}
+		return filepath.Join(dir, s)
+	}
+	for _, key := range pathSettings {
+		switch v := settings[key].(type) {
+		case nil:
+		case []interface{}:
+			for i := range v {
+				v[i] = resolve(v[i])
+			}
+		default:
+			settings[key] = resolve(v)
+		}
+	}
+	profiles, _ := settings["profiles"].(map[string]interface{})
+	for _, p := range profiles {
+		if ps, ok := p.(map[string]interface{}); ok {
+			resolvePaths(ps, dir)
+		}
+	}
+}
+
+// projectSetting reports whether a project may set the setting, given by its flag name or an alias
+func projectSetting(key string) bool {
+	return slices.Contains(projectAllowed, string(NormalizeFlag(nil, key)))
+}
+
+// dropDenied removes the settings a project may not set, and those of profiles, with a warning.
+// Files have to be named by paths inside the project
+func dropDenied(settings map[string]interface{}, filename string) {
+	var keys []string
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "profiles" || key == "aliases" {
+			continue
+		}
+		if !projectSetting(key) {
+			fmt.Fprintf(os.Stderr, "warning: ignoring %s in %s, set it in %s or on the command line\n", key, filename, DefaultConfigFile())
+			delete(settings, key)
+			continue
+		}
+		if slices.Contains(pathSettings, string(NormalizeFlag(nil, key))) && !projectPaths(settings[key]) {
+			fmt.Fprintf(os.Stderr, "warning: ignoring %s in %s, its paths have to be relative and inside the project\n", key, filename)
+			delete(settings, key)
+		}
+	}
+	profiles, _ := settings["profiles"].(map[string]interface{})
+	for _, p := range profiles {
+		if ps, ok := p.(map[string]interface{}); ok {
+			dropDenied(ps, filename)
+		}
+	}
+}
+
+// projectPaths reports whether a path setting, or each of a list, stays inside the project,
+// with no absolute, ~, or .. paths
+func projectPaths(v interface{}) bool {
+	list, ok := v.([]interface{})
+	if !ok {
+		list = []interface{}{v}
+	}
+	for _, p := range list {
+		s := fmt.Sprint(p)
+		if !filepath.IsLocal(s) || strings.HasPrefix(s, "~") {
+			return false
+		}
+	}
+	return true
+}
+
+// ProfileSettings returns the settings of the named profile in the config settings
+func ProfileSettings(settings map[string]interface{}, name string) (map[string]interface{}, error) {
+	profiles, _ := settings["profiles"].(map[string]interface{})
+	p, ok := profiles[name]
+	if !ok {
+		var names []string
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no profile %q, the config file has no profiles", name)
+		}
+		return nil, fmt.Errorf("no profile %q, use one of %s", name, strings.Join(names, ", "))
+	}
+	ps, ok := p.(map[string]interface{})
+	if !ok && p != nil {
+		return nil, fmt.Errorf("profile %q: expected a map of settings", name)
+	}
+	return ps, nil
+}
+
+// SetDefaults applies the config file, the project config, the environment, and then
+// the --profile to the flags that were not given, so the later ones win.
+// Subcommands only get the flags they share with the root, their own flags may mean something else
+func SetDefaults(cmd *cobra.Command) error {
+	root := cmd == cmd.Root()
+	flags := cmd.Flags()
+	if !root {
+		flags = cmd.InheritedFlags()
+	}
+
+	filename := configFile()
+	if _, err := os.Stat(filename); err != nil && filename != DefaultConfigFile() {
+		// a missing --config is a mistake, unlike a missing default file
+		return err
+	}
+	settings, err := LoadConfig(filename)
+	if err != nil {
+		return err
+	}
+	resolvePaths(settings, filepath.Dir(filename))
+	err = SetConfigDefaults(flags, settings, root, "config "+filename)
+	if err != nil {
+		return err
+	}
+
+	// profiles and aliases of the project replace those of the same name
+	profiles := map[string]interface{}{}
+	if p, ok := settings["profiles"].(map[string]interface{}); ok {
+		for name, s := range p {
+			profiles[name] = s
+		}
+	}
+	ModelAliases, err = configAliases(settings, "config "+filename)
+	if err != nil {
+		return err
+	}
+	if project := FindProjectConfig(); project != "" && project != filename {
+		ps, err := LoadConfig(project)
+		if err != nil {
+			return err
+		}
+		dropDenied(ps, project)
+		resolvePaths(ps, filepath.Dir(project))
+		err = SetConfigDefaults(flags, ps, root, "project "+project)
+		if err != nil {
+			return err
+		}
+		if p, ok := ps["profiles"].(map[string]interface{}); ok {
+			for name, s := range p {
+				profiles[name] = s
+			}
+		}
+		aliases, err := configAliases(ps, "project "+project)
+		if err != nil {
+			return err
+		}
+		for name, model := range aliases {
+			ModelAliases[name] = model
+		}
+	}
+
+	err = SetEnvDefaults(flags)
+	if err != nil {
+		return err
+	}
+
+	// the profile may be chosen in the config files too
+	if Profile != "" {
+		profile, err := ProfileSettings(map[string]interface{}{"profiles": profiles}, Profile)
+		if err != nil {
+			return err
+		}
+		err = SetConfigDefaults(flags, profile, root, "profile "+Profile)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, model := range []*string{&Model, &BenchModel, &EmbedModel, &ImageModel, &SpeakModel, &FinetuneModel} {
+		*model = ResolveModel(*model)
+	}
+	return nil
+}
+
+// ModelAliases are the model names of the aliases in the config files
+var ModelAliases = map[string]string{}
+
+// ResolveModel returns the model an alias stands for, other names are returned as they are
+func ResolveModel(name string) string {
+	if model, ok := ModelAliases[name]; ok {
+		return model
+	}
+	return name
+}
+
+// configAliases reads the aliases of the config settings, a map of alias to model name
+func configAliases(settings map[string]interface{}, source string) (map[string]string, error) {
+	aliases := map[string]string{}
+	if settings["aliases"] == nil {
+		return aliases, nil
+	}
+	m, ok := settings["aliases"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: aliases: expected a map of alias names to models", source)
+	}
+	for name, v := range m {
+		model, ok := v.(string)
+		if !ok || model == "" {
+			return nil, fmt.Errorf("%s: aliases: %s: expected a model name", source, name)
+		}
+		aliases[name] = model
+	}
+	return aliases, nil
+}
+
+func NewConfigCmd(root *cobra.Command) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "read and change the settings in the config file",
+		// the settings are what is being changed, and no API key is needed
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+
+	get := &cobra.Command{
+		Use:   "get [setting]",
+		Short: "print the settings in the config file, or the value of one",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := PrintSettings(root, args)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	set := &cobra.Command{
+		Use:   "set <setting> <value...>",
+		Short: "validate and store a setting, repeatable flags take several values",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := SetSetting(root, args[0], args[1:])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	unset := &cobra.Command{
+		Use:   "unset <setting>",
+		Short: "remove a setting, so the flag default is used again",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := UnsetSetting(root, args[0])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	edit := &cobra.Command{
+		Use:   "edit",
+		Short: "change the config file in $EDITOR, it is only saved when valid",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := EditConfig(root)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.AddCommand(get, set, unset, edit)
+	return cmd
+}
+
+// configFile is the --config, $CHATGPT_CONFIG, or the default file
+func configFile() string {
+	if ConfigFile != "" {
+		return ConfigFile
+	}
+	if env := os.Getenv("CHATGPT_CONFIG"); env != "" {
+		return env
+	}
+	return DefaultConfigFile()
+}
+
+// settingFlags are the flags of the root command, which are what can be set
+func settingFlags(root *cobra.Command) *pflag.FlagSet {
+	flags := pflag.NewFlagSet("settings", pflag.ContinueOnError)
+	flags.AddFlagSet(root.Flags())
+	flags.AddFlagSet(root.PersistentFlags())
+	flags.SetNormalizeFunc(NormalizeFlag)
+	return flags
+}
+
+// checkSettings rejects settings that the command would refuse,
+// each profile is checked together with the settings it is used over
+func checkSettings(root *cobra.Command, settings map[string]interface{}, filename string) error {
+	// checking sets the flags, these say which settings are being changed
+	defer func(config, profile string, aliases map[string]string) {
+		ConfigFile, Profile, ModelAliases = config, profile, aliases
+	}(ConfigFile, Profile, ModelAliases)
+
+	var err error
+	ModelAliases, err = configAliases(settings, "config "+filename)
+	if err != nil {
+		return err
+	}
+	err = checkProfile(root, settings, nil, "config "+filename)
+	if err != nil {
+		return err
+	}
+	if _, ok := settings["profiles"]; !ok {
+		return nil
+	}
+	profiles, ok := settings["profiles"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("config %s: profiles: expected a map of profile names to settings", filename)
+	}
+	for name := range profiles {
+		profile, err := ProfileSettings(settings, name)
+		if err != nil {
+			return err
+		}
+		err = checkProfile(root, settings, profile, "profile "+name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkProfile(root *cobra.Command, settings, profile map[string]interface{}, source string) error {
+	flags := settingFlags(root)
+	// start from the defaults, the flags keep values from earlier checks
+	flags.VisitAll(func(f *pflag.Flag) {
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			sv.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+	})
+	err := SetConfigDefaults(flags, settings, true, source)
+	if err == nil {
+		err = SetConfigDefaults(flags, profile, true, source)
+	}
+	if err == nil {
+		err = CheckRanges()
+	}
+	if err == nil {
+		switch ProviderName {
+		case "openai", "azure", "anthropic", "gemini":
+		default:
+			err = fmt.Errorf("unknown provider %q, use openai, azure, anthropic, or gemini", ProviderName)
+		}
+	}
+	if err == nil {
+		err = ValidateModel(ResolveModel(Model))
+	}
+	if err != nil && profile != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	return err
+}
+
+// loadConfigNode reads the config file as yaml nodes, so comments and
+// the order of settings are kept when it is written back
+func loadConfigNode(filename string) (*yaml.Node, error) {
+	var doc yaml.Node
+	b, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	err = yaml.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", filename, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("reading config %s: expected a map of settings", filename)
+	}
+	return &doc, nil
+}
+
+// mapValue returns the value of key in a yaml mapping, adding an empty mapping when create is set
+func mapValue(m *yaml.Node, key string, create bool) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	if !create {
+		return nil
+	}
+	v := &yaml.Node{Kind: yaml.MappingNode}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, v)
+	return v
+}
+
+// settingsNode is the mapping of the --profile settings, or of the top level ones
+func settingsNode(doc *yaml.Node, create bool) *yaml.Node {
+	m := doc.Content[0]
+	if Profile == "" {
+		return m
+	}
+	profiles := mapValue(m, "profiles", create)
+	if profiles == nil {
+		return nil
+	}
+	return mapValue(profiles, Profile, create)
+}
+
+// marshalConfig encodes with the two space indent config files are usually written with
+func marshalConfig(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err := enc.Encode(doc)
+	if err == nil {
+		err = enc.Close()
+	}
+	return buf.Bytes(), err
+}
+
+// writeConfig replaces the config file in one step, so it is never left half written
+func writeConfig(filename string, content []byte) error {
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), ".config-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(content)
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// PrintSettings prints the settings of the config file, or the value of one,
+// which is the flag default when it is not set. With --profile, the settings of the profile
+func PrintSettings(root *cobra.Command, args []string) error {
+	filename := configFile()
+	settings, err := LoadConfig(filename)
+	if err != nil {
+		return err
+	}
+	if Profile != "" {
+		settings, err = ProfileSettings(settings, Profile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(args) == 1 {
+		f := settingFlags(root).Lookup(args[0])
+		if f == nil {
+			return fmt.Errorf("unknown setting %q, settings are long flag names", args[0])
+		}
+		if list, ok := settings[f.Name].([]interface{}); ok {
+			for _, v := range list {
+				fmt.Println(v)
+			}
+		} else if v, ok := settings[f.Name]; ok {
+			fmt.Println(v)
+		} else {
+			fmt.Printf("%s (default)\n", f.DefValue)
+		}
+		return nil
+	}
+
+	if len(settings) == 0 {
+		fmt.Printf("no settings in %s\n", filename)
+		return nil
+	}
+	b, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(b))
+	return nil
+}
+
+// SetSetting validates the value against the other settings and stores it,
+// in the --profile when one is given
+func SetSetting(root *cobra.Command, key string, values []string) error {
+	filename := configFile()
+	f := settingFlags(root).Lookup(key)
+	if f == nil {
+		return fmt.Errorf("unknown setting %q, settings are long flag names", key)
+	}
+	_, repeatable := f.Value.(pflag.SliceValue)
+	if len(values) > 1 && !repeatable {
+		return fmt.Errorf("%s takes a single value", f.Name)
+	}
+
+	value := &yaml.Node{Kind: yaml.ScalarNode, Value: values[0]}
+	if repeatable {
+		value = &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, v := range values {
+			value.Content = append(value.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: v})
+		}
+	}
+
+	doc, err := loadConfigNode(filename)
+	if err != nil {
+		return err
+	}
+	m := settingsNode(doc, true)
+	if m.Kind != yaml.MappingNode {
+		return fmt.Errorf("config %s: profile %s: expected a map of settings", filename, Profile)
+	}
+	found := false
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == f.Name {
+			m.Content[i+1] = value
+			found = true
+		}
+	}
+	if !found {
+		m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.Name}, value)
+	}
+
+	b, err := marshalConfig(doc)
+	if err != nil {
+		return err
+	}
+	var settings map[string]interface{}
+	err = yaml.Unmarshal(b, &settings)
+	if err != nil {
+		return err
+	}
+	err = checkSettings(root, settings, filename)
+	if err != nil {
+		return err
+	}
+	return writeConfig(filename, b)
+}
+
+// UnsetSetting removes a setting from the config file, or from the --profile
+func UnsetSetting(root *cobra.Command, key string) error {
+	filename := configFile()
+	name := key
+	if f := settingFlags(root).Lookup(key); f != nil {
+		name = f.Name
+	}
+
+	doc, err := loadConfigNode(filename)
+	if err != nil {
+		return err
+	}
+	m := settingsNode(doc, false)
+	for i := 0; m != nil && i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == name {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			b, err := marshalConfig(doc)
+			if err != nil {
+				return err
+			}
+			return writeConfig(filename, b)
+		}
+	}
+	if Profile != "" {
+		return fmt.Errorf("%s is not set in profile %s of %s", key, Profile, filename)
+	}
+	return fmt.Errorf("%s is not set in %s", key, filename)
+}
+
+// EditConfig opens the config file in $EDITOR, offering to edit again until it is valid
+func EditConfig(root *cobra.Command) error {
+	filename := configFile()
+	b, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	text := string(b)
+	for {
+		text, err = EditText(text)
+		if err != nil {
+			return err
+		}
+		var settings map[string]interface{}
+		err = yaml.Unmarshal([]byte(text), &settings)
+		if err == nil {
+			err = checkSettings(root, settings, filename)
+		}
+		if err == nil {
+			return writeConfig(filename, []byte(text))
+		}
+		fmt.Println(err)
+		if !confirm("edit again?") {
+			return fmt.Errorf("%s was not changed", filename)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestDropDenied(t *testing.T) {
+	// a cloned repository turning on headers for its own context could set any flag
+	settings := map[string]interface{}{
+		"parse-headers": true,
+		"context":       "notes.md",
+		"until":         "touch /tmp/pwned",
+		"tools-file":    "tools.yaml",
+		"write":         true,
+		"api-base":      "http://example.com",
+		"model":         "gpt-4o",
+		"pretext":       "be brief",
+		"profiles": map[string]interface{}{
+			"p": map[string]interface{}{"parse-headers": true, "temp": 0.2},
+		},
+	}
+	dropDenied(settings, ".chatgpt.yaml")
+
+	var kept []string
+	for key := range settings {
+		kept = append(kept, key)
+	}
+	sort.Strings(kept)
+	want := []string{"context", "model", "pretext", "profiles"}
+	if len(kept) != len(want) {
+		t.Fatalf("kept %v, want %v", kept, want)
+	}
+	for i := range want {
+		if kept[i] != want[i] {
+			t.Fatalf("kept %v, want %v", kept, want)
+		}
+	}
+
+	profile := settings["profiles"].(map[string]interface{})["p"].(map[string]interface{})
+	if _, ok := profile["parse-headers"]; ok {
+		t.Errorf("profile kept parse-headers")
+	}
+	if _, ok := profile["temp"]; !ok {
+		t.Errorf("profile dropped temp")
+	}
+}
+
+func TestDropDeniedPaths(t *testing.T) {
+	for _, tt := range []struct {
+		context interface{}
+		kept    bool
+	}{
+		{"notes.md", true},
+		{"docs/notes.md", true},
+		{[]interface{}{"a.md", "b/c.md"}, true},
+		{"/etc/passwd", false},
+		{"../secrets.txt", false},
+		{"docs/../../secrets.txt", false},
+		{"~/.ssh/id_rsa", false},
+		{[]interface{}{"a.md", "/etc/passwd"}, false},
+	} {
+		settings := map[string]interface{}{"context": tt.context}
+		dropDenied(settings, ".chatgpt.yaml")
+		if _, ok := settings["context"]; ok != tt.kept {
+			t.Errorf("context %v: kept %v, want %v", tt.context, ok, tt.kept)
+		}
+	}
+}
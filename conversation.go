@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// Conversation holds the messages of a session, the source of truth for
+// what is sent, saved, and trimmed. Completion models get it
+// rendered to a single prompt with Render
+type Conversation struct {
+	Messages []gpt3.ChatCompletionMessage
+
+	// the number of leading messages from the pretext, context, and question
+	initial int
+}
+
+// Session is the conversation of the current run
+var Session Conversation
+
+// NewConversation starts a conversation with the pretext as the system message
+// and the context and question, in the --question-position order, as the first user message
+func NewConversation(pretext, context, question string) Conversation {
+	var c Conversation
+	if pretext != "" {
+		c.Add(SystemMessage(pretext))
+	}
+
+	// joined the way the original completion prompt was, so rendering stays the same
+	var content string
+	if QuestionPosition == "before" && question != "" && !EditMode {
+		// edits keep the context as the input, the question is the instruction
+		content = question
+		if context != "" {
+			content += "\n" + context
+		}
+	} else if EditMode || PromptFormat == "openai" {
+		content = context
+		if question != "" {
+			content += "\n" + question
+		}
+	} else {
+		var parts []string
+		if context != "" {
+			parts = append(parts, strings.TrimSuffix(context, "\n"))
+		}
+		if question != "" {
+			parts = append(parts, question)
+		}
+		content = strings.Join(parts, "\n")
+	}
+
+	if content != "" {
+		c.Add(UserMessage(content))
+	}
+	c.initial = len(c.Messages)
+	return c
+}
+
+func (c *Conversation) Add(messages ...gpt3.ChatCompletionMessage) {
+	c.Messages = append(c.Messages, messages...)
+}
+
+// Reset forgets what was said after the pretext, context, and question the session started with
+func (c *Conversation) Reset() {
+	// trimming to fit the context window can have taken some of them
+	c.initial = min(c.initial, len(c.Messages))
+	c.Messages = c.Messages[:c.initial]
+}
+
+// DropAnswer takes back the response to the last question, so it can be asked again.
+// It reports false when there is no question to ask
+func (c *Conversation) DropAnswer() bool {
+	n := len(c.Messages)
+	answered := n > c.initial && c.Messages[n-1].Role == gpt3.ChatMessageRoleAssistant
+	if answered {
+		n--
+	}
+	// the context the session started with is only a question once it was answered
+	if n == 0 || c.Messages[n-1].Role != gpt3.ChatMessageRoleUser || (!answered && n <= c.initial) {
+		return false
+	}
+	c.Messages = c.Messages[:n]
+	return true
+}
+
+// Undo takes back the last question and the response to it, returning the question.
+// It reports false when nothing was asked after the initial messages
+func (c *Conversation) Undo() (string, bool) {
+	for i := len(c.Messages) - 1; i > c.initial; i-- {
+		if c.Messages[i].Role != gpt3.ChatMessageRoleAssistant {
+			continue
+		}
+		if c.Messages[i-1].Role != gpt3.ChatMessageRoleUser {
+			return "", false
+		}
+		question := c.Messages[i-1].Content
+		c.Messages = append(c.Messages[:i-1], c.Messages[i+1:]...)
+		return question, true
+	}
+	return "", false
+}
+
+// Copy returns a conversation that can be added to without changing c
+func (c *Conversation) Copy() Conversation {
+	cp := *c
+	cp.Messages = append([]gpt3.ChatCompletionMessage(nil), c.Messages...)
+	return cp
+}
+
+// Redact replaces the secrets in every message, for --redact
+func (c *Conversation) Redact() {
+	for i := range c.Messages {
+		c.Messages[i].Content = Redact(c.Messages[i].Content)
+	}
+}
+
+func SystemMessage(content string) gpt3.ChatCompletionMessage {
+	return gpt3.ChatCompletionMessage{Role: gpt3.ChatMessageRoleSystem, Content: content}
+}
+
+func UserMessage(content string) gpt3.ChatCompletionMessage {
+	return gpt3.ChatCompletionMessage{Role: gpt3.ChatMessageRoleUser, Content: content}
+}
+
+func AssistantMessage(content string) gpt3.ChatCompletionMessage {
+	return gpt3.ChatCompletionMessage{Role: gpt3.ChatMessageRoleAssistant, Content: content}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// USD per 1K tokens, as {prompt, completion}
+var modelPrices = map[string][2]float64{
+	gpt3.GPT3TextDavinci003: {0.02, 0.02},
+	gpt3.GPT3TextDavinci002: {0.02, 0.02},
+	gpt3.GPT3TextCurie001:   {0.002, 0.002},
+	gpt3.GPT3TextBabbage001: {0.0005, 0.0005},
+	gpt3.GPT3TextAda001:     {0.0004, 0.0004},
+	gpt3.GPT3Davinci:        {0.02, 0.02},
+	gpt3.GPT3Curie:          {0.002, 0.002},
+	gpt3.GPT3Babbage:        {0.0005, 0.0005},
+	gpt3.GPT3Ada:            {0.0004, 0.0004},
+	gpt3.GPT3Dot5Turbo:      {0.002, 0.002},
+	"gpt-4":                 {0.03, 0.06},
+	"gpt-4-32k":             {0.06, 0.12},
+	"gpt-4-turbo":           {0.01, 0.03},
+	"gpt-4o":                {0.0025, 0.01},
+	"gpt-4o-mini":           {0.00015, 0.0006},
+	"o1":                    {0.015, 0.06},
+	"o1-mini":               {0.003, 0.012},
+	"o3-mini":               {0.0011, 0.0044},
+	"claude-3-opus":         {0.015, 0.075},
+	"claude-3-5-sonnet":     {0.003, 0.015},
+	"claude-3-5-haiku":      {0.0008, 0.004},
+	"claude-3-haiku":        {0.00025, 0.00125},
+	"gemini-1.5-pro":        {0.00125, 0.005},
+	"gemini-1.5-flash":      {0.000075, 0.0003},
+	// embeddings have no completion
+	"text-embedding-3-small": {0.00002, 0},
+	"text-embedding-3-large": {0.00013, 0},
+	"text-embedding-ada-002": {0.0001, 0},
+	// speech is priced per 1K characters of input
+	"tts-1":    {0.015, 0},
+	"tts-1-hd": {0.03, 0},
+}
+
+// USD per image, at the standard quality and smallest size
+var imagePrices = map[string]float64{
+	gpt3.CreateImageModelDallE2:    0.016,
+	gpt3.CreateImageModelDallE3:    0.04,
+	gpt3.CreateImageModelGptImage1: 0.011,
+}
+
+// USD per 1K trained tokens
+var trainingPrices = map[string]float64{
+	gpt3.GPT3Dot5Turbo:  0.008,
+	"gpt-4o-mini":       0.003,
+	"gpt-4o":            0.025,
+	gpt3.GPT3Davinci002: 0.006,
+	gpt3.GPT3Babbage002: 0.0004,
+}
+
+// EstimateCost returns the USD cost of usage for model, and false when the price is unknown.
+// Dated snapshots, like gpt-4-0314, are priced as their base model
+func EstimateCost(model string, usage gpt3.Usage) (float64, bool) {
+	price, ok := basePrice(modelPrices, model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(usage.PromptTokens)*price[0] + float64(usage.CompletionTokens)*price[1]) / 1000, true
+}
+
+// EstimateTrainingCost returns the USD cost of fine-tuning model on tokens for epochs,
+// and false when the price is unknown
+func EstimateTrainingCost(model string, tokens, epochs int) (float64, bool) {
+	price, ok := basePrice(trainingPrices, model)
+	if !ok {
+		return 0, false
+	}
+	return float64(tokens*epochs) * price / 1000, true
+}
+
+// basePrice looks up model, then the model with each -suffix taken off in turn
+func basePrice[T any](prices map[string]T, model string) (T, bool) {
+	price, ok := prices[model]
+	for !ok {
+		i := strings.LastIndex(model, "-")
+		if i < 0 {
+			return price, false
+		}
+		model = model[:i]
+		price, ok = prices[model]
+	}
+	return price, true
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// the keys of the providers, the only variables a .env of the working directory can set besides
+// those of the settings a project may set. Others, like EDITOR, SSL_CERT_FILE, or HTTPS_PROXY,
+// would let a cloned repository run commands or send the key elsewhere
+var dotenvKeys = []string{"CHATGPT_API_KEY", "OPENAI_API_KEY", "ANTHROPIC_API_KEY", "GEMINI_API_KEY"}
+
+// the file each variable set by LoadDotEnv came from
+var dotenvFiles = map[string]string{}
+
+// DefaultDotEnv is ~/.chatgpt.env
+func DefaultDotEnv() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".chatgpt.env")
+}
+
+// LoadDotEnv sets the variables of .env in the working directory, then of ~/.chatgpt.env,
+// which are not already set, so the environment wins and then the project
+func LoadDotEnv() error {
+	err := loadDotEnv(".env", true)
+	if err == nil {
+		err = loadDotEnv(DefaultDotEnv(), false)
+	}
+	return err
+}
+
+func loadDotEnv(filename string, project bool) error {
+	if filename == "" {
+		return nil
+	}
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return fmt.Errorf("%s:%d: expected NAME=value", filename, n)
+		}
+		value, err = dotenvValue(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", filename, n, err)
+		}
+
+		if project && deniedEnv(name) {
+			fmt.Fprintf(os.Stderr, "warning: ignoring %s in %s, set it in %s or the environment\n", name, filename, DefaultDotEnv())
+			continue
+		}
+		if _, set := os.LookupEnv(name); !set {
+			os.Setenv(name, value)
+			dotenvFiles[name] = filename
+		}
+	}
+	return scanner.Err()
+}
+
+// envSource names where a variable was set, for --show-config
+func envSource(name string) string {
+	if filename, ok := dotenvFiles[name]; ok {
+		return "env " + name + " from " + filename
+	}
+	return "env " + name
+}
+
+// dotenvValue unquotes a value, single quotes are literal, double quotes take \n escapes,
+// and unquoted values end at a ' #' comment
+func dotenvValue(v string) (string, error) {
+	if len(v) > 0 && (v[0] == '"' || v[0] == '\'') {
+		end := strings.LastIndexByte(v, v[0])
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quote")
+		}
+		if v[0] == '\'' {
+			return v[1:end], nil
+		}
+		r := strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`)
+		return r.Replace(v[1:end]), nil
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return v, nil
+}
+
+// deniedEnv reports whether a project .env may not set the variable,
+// it can only set the dotenvKeys and the variables of settings a project may set
+func deniedEnv(name string) bool {
+	if slices.Contains(dotenvKeys, name) {
+		return false
+	}
+	for _, e := range envFlags {
+		if e[1] == name {
+			return !dotenvSetting(e[0])
+		}
+	}
+	// every flag has a CHATGPT_ variable, see EnvName
+	if strings.HasPrefix(name, "CHATGPT_") {
+		return !dotenvSetting(strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(name, "CHATGPT_"), "_", "-")))
+	}
+	return true
+}
+
+// dotenvSetting reports whether a project .env may set the setting, as a project config can,
+// but not files, whose paths are only checked in the config
+func dotenvSetting(key string) bool {
+	return projectSetting(key) && !slices.Contains(pathSettings, string(NormalizeFlag(nil, key)))
+}
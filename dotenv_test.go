@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestDeniedEnv(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		denied bool
+	}{
+		{"OPENAI_API_KEY", false},
+		{"ANTHROPIC_API_KEY", false},
+		{"CHATGPT_MODEL", false},
+		{"CHATGPT_TEMPERATURE", false},
+		{"CHATGPT_TOKENS", false},
+		// they run commands, choose the trusted certificates, or send the key elsewhere
+		{"EDITOR", true},
+		{"SSL_CERT_FILE", true},
+		{"HTTPS_PROXY", true},
+		{"CHATGPT_API_BASE", true},
+		{"CHATGPT_CONFIG", true},
+		{"CHATGPT_UNTIL", true},
+		{"CHATGPT_PARSE_HEADERS", true},
+		{"CHATGPT_PROMPT_DIR", true},
+		{"OPENAI_ORG_ID", true},
+	} {
+		if got := deniedEnv(tt.name); got != tt.denied {
+			t.Errorf("deniedEnv(%s) = %v, want %v", tt.name, got, tt.denied)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+const editInstructions = `You edit documents. Apply the user's instruction to the document and reply with only the complete edited document.
+Do not explain the changes, do not add a code fence, and keep the indentation and formatting of the parts you do not change.`
+
+// GetChatEditResponse makes edits with chat models, which replaced the edits endpoint.
+// The user messages are the document, and any pretext is added to the instructions.
+// The responses are only the edited documents, with the input's indentation and trailing newline
+func GetChatEditResponse(ctx context.Context, conv *Conversation, instruction string) ([]string, error) {
+	if strings.TrimSpace(instruction) == "" {
+		return nil, fmt.Errorf("edit mode needs an instruction, give it with -q")
+	}
+
+	messages := []gpt3.ChatCompletionMessage{SystemMessage(editInstructions)}
+	var parts []string
+	for _, m := range conv.Messages {
+		if m.Role == gpt3.ChatMessageRoleSystem {
+			messages = append(messages, m)
+		} else if m.Role == gpt3.ChatMessageRoleUser {
+			parts = append(parts, m.Content)
+		}
+	}
+	document := strings.Join(parts, "\n")
+	messages = append(messages, UserMessage("Instruction: "+instruction+"\n\nDocument:\n"+document))
+
+	R, err := GetChatCompletionResponse(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range R {
+		R[i] = MatchLayout(document, StripFence(r))
+	}
+	return R, nil
+}
+
+// StripFence removes a code fence wrapped around the whole text
+func StripFence(text string) string {
+	t := strings.TrimSpace(text)
+	if !strings.HasPrefix(t, "```") || !strings.HasSuffix(t, "```") || len(t) < 6 {
+		return text
+	}
+	t = strings.TrimSuffix(t, "```")
+	// drop the opening fence and its language tag
+	_, body, ok := strings.Cut(t, "\n")
+	if !ok {
+		return text
+	}
+	return body
+}
+
+// MatchLayout gives the edited text the indentation shared by the lines of
+// the original, when the model dropped it, and the original's trailing newlines
+func MatchLayout(original, edited string) string {
+	edited = strings.TrimRight(edited, "\n")
+	if indent := commonIndent(original); indent != "" && commonIndent(edited) == "" {
+		lines := strings.Split(edited, "\n")
+		for i, l := range lines {
+			if strings.TrimSpace(l) != "" {
+				lines[i] = indent + l
+			}
+		}
+		edited = strings.Join(lines, "\n")
+	}
+	return edited + original[len(strings.TrimRight(original, "\n")):]
+}
+
+// commonIndent returns the leading whitespace every non-empty line starts with
+func commonIndent(text string) string {
+	indent, first := "", true
+	for _, l := range strings.Split(text, "\n") {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		lead := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+		if first {
+			indent, first = lead, false
+			continue
+		}
+		for !strings.HasPrefix(lead, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	return indent
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+var EmbedModel string
+var EmbedOutput string
+var EmbedLines bool
+var EmbedDimensions int
+
+// EmbedResult is the vector for one input, named by its file, or its line with --lines
+type EmbedResult struct {
+	Input     string    `json:"input"`
+	Embedding []float32 `json:"embedding"`
+}
+
+func NewEmbedCmd(client *gpt3.Client) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "embed [file...]",
+		Short: "print embedding vectors of files, or stdin, as JSON",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := Embed(client, context.Background(), args)
+			if err != nil {
+				PrintError(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&EmbedModel, "model", "m", string(gpt3.SmallEmbedding3), "select the embedding model")
+	cmd.Flags().StringVarP(&EmbedOutput, "output", "o", "", "write the JSON to this file instead of stdout")
+	cmd.Flags().BoolVarP(&EmbedLines, "lines", "", false, "embed each non-empty line on its own, instead of each file")
+	cmd.Flags().IntVarP(&EmbedDimensions, "dimensions", "", 0, "shorten the vectors to this many dimensions, text-embedding-3 models only (0 disables)")
+
+	return cmd
+}
+
+// Embed writes a JSON array of EmbedResult for the files, or stdin when there are none
+func Embed(client *gpt3.Client, ctx context.Context, files []string) error {
+	var names, inputs []string
+	add := func(name, text string) {
+		if !EmbedLines {
+			names, inputs = append(names, name), append(inputs, text)
+			return
+		}
+		for _, line := range strings.Split(text, "\n") {
+			if strings.TrimSpace(line) != "" {
+				names, inputs = append(names, line), append(inputs, line)
+			}
+		}
+	}
+
+	if len(files) == 0 {
+		text, err := ReadStdin()
+		if err != nil {
+			return err
+		}
+		add("-", text)
+	}
+	for _, f := range files {
+		text, err := ReadContextFile(f)
+		if err != nil {
+			return err
+		}
+		add(f, text)
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("there is nothing to embed")
+	}
+
+	err := CheckBudget()
+	if err != nil {
+		return err
+	}
+	resp, err := client.CreateEmbeddings(ctx, gpt3.EmbeddingRequest{
+		Input:      inputs,
+		Model:      gpt3.EmbeddingModel(EmbedModel),
+		Dimensions: EmbedDimensions,
+		User:       User,
+	})
+	if err != nil {
+		return err
+	}
+	RecordSpend(EmbedModel, resp.Usage)
+
+	results := make([]EmbedResult, len(inputs))
+	for _, d := range resp.Data {
+		if d.Index < len(results) {
+			results[d.Index] = EmbedResult{Input: names[d.Index], Embedding: d.Embedding}
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if EmbedOutput != "" {
+		f, err := os.Create(EmbedOutput)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	return json.NewEncoder(out).Encode(results)
+}
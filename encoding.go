@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/spf13/pflag"
+)
+
+// windows-1252 differs from latin-1 only in the 0x80-0x9F range
+var cp1252 = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\u008d', 'Ž', '\u008f',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\u009d', 'ž', 'Ÿ',
+}
+
+// ReadContextFile reads a context file and makes sure the content is UTF-8.
+// Without ForceUTF8 the content is returned as is with a warning when invalid,
+// otherwise BOMs are used to detect UTF-16 and invalid UTF-8 is assumed to be Windows-1252.
+// Source files are line numbered when LineNumbers is set
+func ReadContextFile(filename string) (string, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	text := string(content)
+	if ForceUTF8 {
+		text = ToUTF8(content)
+	} else if !utf8.Valid(content) {
+		fmt.Fprintf(os.Stderr, "warning: %s is not valid UTF-8, use --force-utf8 to transcode it\n", filename)
+	}
+
+	if LineNumbers {
+		text = NumberLines(filename, text)
+	}
+	return text, nil
+}
+
+// ReadContextFiles reads and joins the files, putting the --context-separator
+// before each when there are several. Headers are applied per file
+func ReadContextFiles(filenames []string, flags *pflag.FlagSet) (string, error) {
+	text := ""
+	for _, f := range filenames {
+		content, err := ReadContextFile(f)
+		if err != nil {
+			return "", err
+		}
+		if ParseFileHeaders {
+			content, err = ParseHeaders(content, flags)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", f, err)
+			}
+		}
+
+		if len(filenames) > 1 && !NoContextSeparator {
+			// keep each file starting on its own line
+			if text != "" && !strings.HasSuffix(text, "\n") {
+				text += "\n"
+			}
+			text += strings.ReplaceAll(ContextSeparator, "{file}", f)
+		}
+		text += content
+	}
+	return text, nil
+}
+
+// ToUTF8 detects the encoding of b and transcodes it to UTF-8
+func ToUTF8(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xEF, 0xBB, 0xBF}):
+		return string(b[3:])
+	case bytes.HasPrefix(b, []byte{0xFF, 0xFE}):
+		return decodeUTF16(b[2:], false)
+	case bytes.HasPrefix(b, []byte{0xFE, 0xFF}):
+		return decodeUTF16(b[2:], true)
+	case utf8.Valid(b):
+		return string(b)
+	}
+
+	// legacy single byte encoding, most likely from windows
+	var sb strings.Builder
+	for _, c := range b {
+		if c >= 0x80 && c <= 0x9F {
+			sb.WriteRune(cp1252[c-0x80])
+		} else {
+			sb.WriteRune(rune(c))
+		}
+	}
+	return sb.String()
+}
+
+func decodeUTF16(b []byte, bigEndian bool) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		if bigEndian {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		} else {
+			u = append(u, uint16(b[i+1])<<8|uint16(b[i]))
+		}
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// errorHints map substrings of API errors to what went wrong and how to fix it.
+// The first matching hint wins, so more specific ones come first
+var errorHints = []struct {
+	match []string
+	hint  string
+}{
+	{
+		[]string{"insufficient_quota", "exceeded your current quota", "billing"},
+		"your account is out of credit or has no billing set up,\ncheck https://platform.openai.com/account/billing",
+	},
+	{
+		[]string{"status code: 429", "rate limit", "Rate limit"},
+		"you are sending requests too quickly, wait a moment and try again,\nor lower --count and --tokens, limits are at https://platform.openai.com/account/rate-limits",
+	},
+	{
+		[]string{"status code: 401", "Incorrect API key", "invalid_api_key"},
+		"the API key was rejected, check the key 'chatgpt --show-config' says is used,\nkeys can be managed at https://platform.openai.com/account/api-keys",
+	},
+	{
+		[]string{"maximum context length", "context_length_exceeded"},
+		"the prompt and --tokens together are more than the model can handle,\nlower --tokens, use less context, or 'save' and start a new session",
+	},
+	{
+		[]string{"model_not_found", "does not exist"},
+		"the model does not exist or your key cannot use it,\nlist what is available with 'models' in interactive mode",
+	},
+	{
+		[]string{"please use CreateChatCompletion", "only gpt-3.5-turbo"},
+		"this model does not support the selected endpoint,\nchat models and completion models are not interchangeable, pick a different --model",
+	},
+	{
+		[]string{"unsupported_country_region_territory", "region, or territory not supported"},
+		"the API is not available in your region",
+	},
+	{
+		[]string{"request timed out after"},
+		"the API did not answer in time, try again or raise --timeout,\nstatus is at https://status.openai.com",
+	},
+	{
+		[]string{"certificate signed by unknown authority", "failed to verify certificate"},
+		"the certificate of the server is not trusted, behind a TLS-intercepting proxy\ngive its root certificate with --ca-cert",
+	},
+	{
+		[]string{"no such host", "connection refused", "i/o timeout", "network is unreachable"},
+		"the API could not be reached, check your network connection and any proxy settings",
+	},
+	{
+		[]string{"status code: 500", "status code: 502", "status code: 503"},
+		"the API had a problem on its side, try again shortly,\nstatus is at https://status.openai.com",
+	},
+}
+
+// ExplainError returns a human-friendly explanation of err, or "" when it is not recognized
+func ExplainError(err error) string {
+	if err == nil {
+		return ""
+	}
+	msg := err.Error()
+	for _, h := range errorHints {
+		for _, m := range h.match {
+			if strings.Contains(msg, m) {
+				return h.hint
+			}
+		}
+	}
+	return ""
+}
+
+// PrintError prints err followed by its explanation, when there is one
+func PrintError(err error) {
+	Logger.Error("exiting", "error", err.Error(), "error_type", errorType(err))
+	fmt.Println(err)
+	if hint := ExplainError(err); hint != "" {
+		fmt.Println("\n" + hint)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+var FinetuneModel string
+var FinetuneSuffix string
+var FinetuneValidation string
+
+func NewFinetuneCmd(client *gpt3.Client) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "finetune",
+		Short: "train custom models, then use them with --model",
+	}
+
+	// every subcommand fails the same way
+	run := func(f func(ctx context.Context, args []string) error) func(*cobra.Command, []string) {
+		return func(cmd *cobra.Command, args []string) {
+			err := f(context.Background(), args)
+			if err != nil {
+				PrintError(err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	upload := &cobra.Command{
+		Use:   "upload <file.jsonl>",
+		Short: "upload training data, printing its file id",
+		Args:  cobra.ExactArgs(1),
+		Run: run(func(ctx context.Context, args []string) error {
+			id, err := uploadTrainingFile(client, ctx, args[0])
+			if err == nil {
+				fmt.Println(id)
+			}
+			return err
+		}),
+	}
+
+	create := &cobra.Command{
+		Use:   "create <file id or file.jsonl>",
+		Short: "start a fine-tuning job, uploading the training data first when given a path",
+		Args:  cobra.ExactArgs(1),
+		Run: run(func(ctx context.Context, args []string) error {
+			return CreateFinetune(client, ctx, args[0])
+		}),
+	}
+	create.Flags().StringVarP(&FinetuneModel, "model", "m", "gpt-4o-mini-2024-07-18", "base model to fine-tune")
+	create.Flags().StringVarP(&FinetuneSuffix, "suffix", "", "", "added to the name of the fine-tuned model")
+	create.Flags().StringVarP(&FinetuneValidation, "validation-file", "", "", "validation data, a file id or a path to upload")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "list fine-tuning jobs, newest first",
+		Args:  cobra.NoArgs,
+		Run: run(func(ctx context.Context, args []string) error {
+			return ListFinetunes(ctx)
+		}),
+	}
+
+	status := &cobra.Command{
+		Use:   "status <job id>",
+		Short: "show a fine-tuning job and its latest events",
+		Args:  cobra.ExactArgs(1),
+		Run: run(func(ctx context.Context, args []string) error {
+			return FinetuneStatus(client, ctx, args[0])
+		}),
+	}
+
+	cancel := &cobra.Command{
+		Use:   "cancel <job id>",
+		Short: "cancel a fine-tuning job",
+		Args:  cobra.ExactArgs(1),
+		Run: run(func(ctx context.Context, args []string) error {
+			job, err := client.CancelFineTuningJob(ctx, args[0])
+			if err == nil {
+				fmt.Printf("%s %s\n", job.ID, job.Status)
+			}
+			return err
+		}),
+	}
+
+	cmd.AddCommand(upload, create, list, status, cancel)
+	return cmd
+}
+
+// uploadTrainingFile uploads a path and returns its file id, ids are returned as they are
+func uploadTrainingFile(client *gpt3.Client, ctx context.Context, file string) (string, error) {
+	if strings.HasPrefix(file, "file-") {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			return file, nil
+		}
+	}
+	f, err := client.CreateFile(ctx, gpt3.FileRequest{
+		FileName: filepath.Base(file),
+		FilePath: file,
+		Purpose:  string(gpt3.PurposeFineTune),
+	})
+	if err != nil {
+		return "", err
+	}
+	Notef("uploaded %s as %s\n", file, f.ID)
+	return f.ID, nil
+}
+
+// the number of epochs usually picked for small training files, the cost is estimated with it
+const finetuneEpochs = 3
+
+func CreateFinetune(client *gpt3.Client, ctx context.Context, training string) error {
+	err := CheckBudget()
+	if err != nil {
+		return err
+	}
+	trainingID, err := uploadTrainingFile(client, ctx, training)
+	if err != nil {
+		return err
+	}
+	req := gpt3.FineTuningJobRequest{
+		TrainingFile: trainingID,
+		Model:        FinetuneModel,
+		Suffix:       FinetuneSuffix,
+	}
+	if FinetuneValidation != "" {
+		req.ValidationFile, err = uploadTrainingFile(client, ctx, FinetuneValidation)
+		if err != nil {
+			return err
+		}
+	}
+
+	job, err := client.CreateFineTuningJob(ctx, req)
+	if err != nil {
+		return err
+	}
+	// the data is only at hand when it was uploaded from a path
+	if b, err := os.ReadFile(training); err == nil {
+		if cost, ok := EstimateTrainingCost(FinetuneModel, EstimateTokens(string(b)), finetuneEpochs); ok {
+			RecordCost(cost)
+		} else {
+			warnUnpriced(FinetuneModel)
+		}
+	}
+	fmt.Printf("%s %s\n", job.ID, job.Status)
+	Notef("check on it with 'chatgpt finetune status %s'\n", job.ID)
+	return nil
+}
+
+// ListFinetunes prints a line per job, the client has no call for listing them
+func ListFinetunes(ctx context.Context) error {
+	var list struct {
+		Data []gpt3.FineTuningJob `json:"data"`
+	}
+	err := GetAPI(ctx, "/fine_tuning/jobs", &list)
+	if err != nil {
+		return err
+	}
+	for _, j := range list.Data {
+		fmt.Printf("%s  %-10s  %s  %s\n", j.ID, j.Status, time.Unix(j.CreatedAt, 0).Format("2006-01-02 15:04"), finetuneName(j))
+	}
+	return nil
+}
+
+// finetuneName is the model to give --model, or the base model until it is trained
+func finetuneName(j gpt3.FineTuningJob) string {
+	if j.FineTunedModel != "" {
+		return j.FineTunedModel
+	}
+	return "(from " + j.Model + ")"
+}
+
+func FinetuneStatus(client *gpt3.Client, ctx context.Context, id string) error {
+	job, err := client.RetrieveFineTuningJob(ctx, id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("id:      %s\n", job.ID)
+	fmt.Printf("status:  %s\n", job.Status)
+	fmt.Printf("model:   %s\n", finetuneName(job))
+	if job.TrainedTokens > 0 {
+		fmt.Printf("tokens:  %d\n", job.TrainedTokens)
+	}
+
+	events, err := client.ListFineTuningJobEvents(ctx, id, gpt3.ListFineTuningJobEventsWithLimit(10))
+	if err != nil {
+		return err
+	}
+	// events come newest first
+	for i := len(events.Data) - 1; i >= 0; i-- {
+		e := events.Data[i]
+		fmt.Printf("  %s  %s\n", time.Unix(e.CreatedAt, 0).Format("2006-01-02 15:04:05"), e.Message)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// promptFormat describes how a conversation is laid out in a completion prompt.
+// Each field is a fmt pattern wrapping one segment of the conversation
+type promptFormat struct {
+	system string // the pretext
+	user   string // context and questions
+	open   string // starts the reply we want completed
+	reply  string // replies added back to the conversation
+}
+
+var promptFormats = map[string]promptFormat{
+	// openai is special cased in RenderPrompt to keep the original layout
+	"openai": {system: "%s", user: "\n> %s", open: "", reply: "\n%s"},
+	"raw":    {system: "%s\n", user: "%s\n", open: "", reply: "%s\n"},
+	"alpaca": {system: "%s\n\n", user: "### Instruction:\n%s\n\n", open: "### Response:\n", reply: "%s\n\n"},
+	"chatml": {system: "<|im_start|>system\n%s<|im_end|>\n", user: "<|im_start|>user\n%s<|im_end|>\n", open: "<|im_start|>assistant\n", reply: "%s<|im_end|>\n"},
+	"vicuna": {system: "%s\n\n", user: "USER: %s\n", open: "ASSISTANT:", reply: " %s\n"},
+}
+
+func PromptFormatNames() []string {
+	return []string{"openai", "alpaca", "chatml", "vicuna", "raw"}
+}
+
+func currentFormat() promptFormat {
+	// edits take the prompt as the input document, so it is never wrapped
+	if EditMode {
+		return promptFormats["openai"]
+	}
+	return promptFormats[PromptFormat]
+}
+
+// Render lays out the conversation as a completion prompt for the current format.
+// When open is set, and the last message is from the user, the prompt ends by
+// starting the reply so there is something to complete
+func (c *Conversation) Render(open bool) string {
+	f := currentFormat()
+	openai := EditMode || PromptFormat == "openai"
+
+	text := ""
+	for i, m := range c.Messages {
+		switch m.Role {
+		case gpt3.ChatMessageRoleSystem:
+			if openai && i > 0 {
+				text += "\n" + m.Content
+			} else {
+				text += fmt.Sprintf(f.system, m.Content)
+			}
+
+		case gpt3.ChatMessageRoleUser:
+			// the context and question are not marked as a turn by openai
+			if openai && i < c.initial {
+				text += m.Content
+			} else {
+				text += fmt.Sprintf(f.user, m.Content)
+			}
+
+		case gpt3.ChatMessageRoleAssistant:
+			text += f.open + fmt.Sprintf(f.reply, m.Content)
+		}
+	}
+
+	if open && len(c.Messages) > 0 && c.Messages[len(c.Messages)-1].Role == gpt3.ChatMessageRoleUser {
+		text += f.open
+	}
+	return text
+}
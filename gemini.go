@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+const defaultGeminiURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// geminiProvider serves Gemini models through the Google AI API
+type geminiProvider struct {
+	url string
+	key string
+}
+
+func newGeminiProvider(base string, primary bool) (*geminiProvider, error) {
+	key, err := vendorKey("gemini", "GEMINI_API_KEY", primary)
+	if err != nil {
+		return nil, err
+	}
+	p := &geminiProvider{url: defaultGeminiURL, key: key}
+	if base != "" {
+		p.url = strings.TrimRight(base, "/")
+	}
+	return p, nil
+}
+
+type geminiPart struct {
+	Text       string            `json:"text,omitempty"`
+	InlineData *geminiInlineData `json:"inlineData,omitempty"`
+}
+
+type geminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiConfig struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             float64  `json:"topP,omitempty"`
+	MaxOutputTokens  int      `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string `json:"stopSequences,omitempty"`
+	CandidateCount   int      `json:"candidateCount,omitempty"`
+	PresencePenalty  float64  `json:"presencePenalty,omitempty"`
+	FrequencyPenalty float64  `json:"frequencyPenalty,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	ResponseMimeType string   `json:"responseMimeType,omitempty"`
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent  `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent `json:"contents"`
+	GenerationConfig  geminiConfig    `json:"generationConfig"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content geminiContent `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// text joins the parts of a candidate
+func (c geminiContent) text() string {
+	var s string
+	for _, p := range c.Parts {
+		s += p.Text
+	}
+	return s
+}
+
+// newGeminiRequest maps the messages to the Gemini API, where system messages are
+// the system instruction, the assistant is the 'model', and roles alternate
+func newGeminiRequest(messages []gpt3.ChatCompletionMessage, opts ChatOptions) (geminiRequest, error) {
+	temp := Temp
+	req := geminiRequest{
+		GenerationConfig: geminiConfig{
+			Temperature:      &temp,
+			MaxOutputTokens:  opts.MaxTokens,
+			StopSequences:    Stop,
+			CandidateCount:   opts.Count,
+			PresencePenalty:  PresencePenalty,
+			FrequencyPenalty: FrequencyPenalty,
+		},
+	}
+	if TopP < 1 {
+		req.GenerationConfig.TopP = TopP
+	}
+	if Seeded {
+		seed := Seed
+		req.GenerationConfig.Seed = &seed
+	}
+	if JSONOutput {
+		req.GenerationConfig.ResponseMimeType = "application/json"
+	}
+
+	var system []geminiPart
+	for _, m := range attachImages(messages) {
+		text := m.Content
+		if CleanPrompt {
+			text = cleanText(text)
+		}
+
+		var parts []geminiPart
+		if text != "" {
+			parts = append(parts, geminiPart{Text: text})
+		}
+		for _, p := range m.MultiContent {
+			if p.Type == gpt3.ChatMessagePartTypeText && p.Text != "" {
+				parts = append(parts, geminiPart{Text: p.Text})
+			} else if p.Type == gpt3.ChatMessagePartTypeImageURL {
+				rest, ok := strings.CutPrefix(p.ImageURL.URL, "data:")
+				if !ok {
+					return req, fmt.Errorf("gemini cannot fetch images, download %s and give the file to --image", p.ImageURL.URL)
+				}
+				mimeType, data, _ := strings.Cut(rest, ";base64,")
+				parts = append(parts, geminiPart{InlineData: &geminiInlineData{MimeType: mimeType, Data: data}})
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+
+		role := "user"
+		switch m.Role {
+		case gpt3.ChatMessageRoleSystem:
+			system = append(system, parts...)
+			continue
+		case gpt3.ChatMessageRoleAssistant:
+			role = "model"
+		}
+		n := len(req.Contents)
+		if n > 0 && req.Contents[n-1].Role == role {
+			req.Contents[n-1].Parts = append(req.Contents[n-1].Parts, parts...)
+		} else {
+			req.Contents = append(req.Contents, geminiContent{Role: role, Parts: parts})
+		}
+	}
+	if len(system) > 0 {
+		req.SystemInstruction = &geminiContent{Parts: system}
+	}
+	return req, nil
+}
+
+// post calls the method of the model, returning API errors as the
+// client would, so they are explained the same way
+func (p *geminiProvider) post(ctx context.Context, method string, req geminiRequest) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/models/%s:%s", p.url, Model, method)
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("x-goog-api-key", p.key)
+
+	resp, err := apiHTTPClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var gr geminiResponse
+		if json.Unmarshal(b, &gr) != nil || gr.Error == nil {
+			return nil, &gpt3.APIError{Message: strings.TrimSpace(string(b)), HTTPStatusCode: resp.StatusCode}
+		}
+		return nil, &gpt3.APIError{Type: gr.Error.Status, Message: gr.Error.Message, HTTPStatusCode: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// generate returns the text of each candidate in the response to req
+func (p *geminiProvider) generate(ctx context.Context, req geminiRequest) ([]string, gpt3.Usage, error) {
+	resp, err := p.post(ctx, "generateContent", req)
+	if err != nil {
+		return nil, gpt3.Usage{}, err
+	}
+	defer resp.Body.Close()
+	var gr geminiResponse
+	err = json.NewDecoder(resp.Body).Decode(&gr)
+	if err != nil {
+		return nil, gpt3.Usage{}, err
+	}
+
+	usage := gpt3.Usage{
+		PromptTokens:     gr.UsageMetadata.PromptTokenCount,
+		CompletionTokens: gr.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:      gr.UsageMetadata.TotalTokenCount,
+	}
+	if len(gr.Candidates) == 0 {
+		return nil, usage, fmt.Errorf("no candidates in the response, the prompt may have been blocked")
+	}
+	var r []string
+	for _, c := range gr.Candidates {
+		r = append(r, c.Content.text())
+	}
+	return r, usage, nil
+}
+
+// Chat sends the messages to a Gemini model
+func (p *geminiProvider) Chat(ctx context.Context, messages []gpt3.ChatCompletionMessage, opts ChatOptions) ([]string, error) {
+	req, err := newGeminiRequest(messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	r, usage, err := p.generate(ctx, req)
+	LastUsage = usage
+	return r, err
+}
+
+// Stream writes the chunks of the server-sent event stream to w
+func (p *geminiProvider) Stream(ctx context.Context, messages []gpt3.ChatCompletionMessage, w io.Writer) (string, error) {
+	req, err := newGeminiRequest(messages, chatFlags())
+	if err != nil {
+		return "", err
+	}
+	resp, err := p.post(ctx, "streamGenerateContent?alt=sse", req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	text := ""
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var gr geminiResponse
+		if err := json.Unmarshal([]byte(data), &gr); err != nil {
+			return text, err
+		}
+		if gr.Error != nil {
+			return text, &gpt3.APIError{Type: gr.Error.Status, Message: gr.Error.Message, HTTPStatusCode: gr.Error.Code}
+		}
+		// each chunk carries the usage so far
+		LastUsage = gpt3.Usage{
+			PromptTokens:     gr.UsageMetadata.PromptTokenCount,
+			CompletionTokens: gr.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:      gr.UsageMetadata.TotalTokenCount,
+		}
+		if len(gr.Candidates) == 0 {
+			continue
+		}
+		chunk := gr.Candidates[0].Content.text()
+		fmt.Fprint(w, chunk)
+		text += chunk
+	}
+	return text, scanner.Err()
+}
@@ -1,13 +1,21 @@
 module github.com/verdverm/chatgpt
 
-go 1.18
+go 1.21
 
 require (
-	github.com/sashabaranov/go-openai v1.5.0
+	github.com/chzyer/readline v1.5.1
+	github.com/sashabaranov/go-openai v1.42.1
 	github.com/spf13/cobra v1.6.1
+	github.com/spf13/pflag v1.0.5
+	github.com/zalando/go-keyring v0.2.3
+	golang.org/x/term v0.8.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
+	github.com/alessio/shellescape v1.4.1 // indirect
+	github.com/danieljoos/wincred v1.2.0 // indirect
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/inconshreveable/mousetrap v1.0.1 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/sys v0.8.0 // indirect
 )
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+const headerPrefix = "#!chatgpt"
+
+// settings a file can give in its headers, the parameters of the request for it.
+// Files come from anywhere, so nothing that runs commands, writes, or sends elsewhere
+var headerSettings = []string{"question", "model", "temp", "topp", "pres", "freq", "tokens", "stop", "count", "seed", "json-output", "logit-bias"}
+
+// ParseHeaders strips leading '#!chatgpt key=value ...' lines from content
+// and applies them to flags that were not set on the command line.
+// Keys are long flag names of the headerSettings, values may be double quoted to include spaces
+func ParseHeaders(content string, flags *pflag.FlagSet) (string, error) {
+	for strings.HasPrefix(content, headerPrefix) {
+		line, rest, _ := strings.Cut(content, "\n")
+		content = rest
+
+		fields, err := splitHeader(strings.TrimPrefix(line, headerPrefix))
+		if err != nil {
+			return "", err
+		}
+
+		for _, field := range fields {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return "", fmt.Errorf("header %q: expected key=value", field)
+			}
+			f := flags.Lookup(key)
+			if f == nil {
+				return "", fmt.Errorf("header %q: unknown flag --%s", field, key)
+			}
+			if !slices.Contains(headerSettings, f.Name) {
+				return "", fmt.Errorf("header %q: --%s cannot be set in a header, only %s", field, key, strings.Join(headerSettings, ", "))
+			}
+			// flags on the command line win
+			if f.Changed {
+				continue
+			}
+			err := f.Value.Set(value)
+			if err != nil {
+				return "", fmt.Errorf("header %q: %w", field, err)
+			}
+			SettingSources[key] = "header"
+		}
+	}
+	return content, nil
+}
+
+// splitHeader splits on spaces, keeping double quoted runs together
+func splitHeader(s string) ([]string, error) {
+	var fields []string
+	var cur strings.Builder
+	quoted := false
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if cur.Len() > 0 {
+				fields = append(fields, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("header %q: unterminated quote", s)
+	}
+	if cur.Len() > 0 {
+		fields = append(fields, cur.String())
+	}
+	return fields, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestParseHeaders(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	model := flags.String("model", "gpt-3.5-turbo", "")
+	tokens := flags.Int("tokens", 1024, "")
+	until := flags.String("until", "", "")
+	flags.Bool("write", false, "")
+
+	content, err := ParseHeaders("#!chatgpt model=gpt-4o tokens=200\nhello\n", flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "hello\n" || *model != "gpt-4o" || *tokens != 200 {
+		t.Errorf("got %q, model %s, tokens %d", content, *model, *tokens)
+	}
+
+	// files come from anywhere, so they cannot run commands or write
+	for _, header := range []string{
+		`#!chatgpt until="touch /tmp/pwned"` + "\nhello\n",
+		"#!chatgpt write=true\nhello\n",
+	} {
+		_, err := ParseHeaders(header, flags)
+		if err == nil {
+			t.Errorf("%q: no error", header)
+		}
+	}
+	if *until != "" {
+		t.Errorf("until was set to %q", *until)
+	}
+}
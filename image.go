@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+var ImageModel string
+var ImageSize string
+var ImageCount int
+var ImageDir string
+
+func NewImageCmd(client *gpt3.Client) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "image <prompt>",
+		Short: "generate images from a prompt, saving them as PNGs and printing their paths",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := GenerateImages(client, context.Background(), strings.Join(args, " "))
+			if err != nil {
+				PrintError(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&ImageModel, "model", "m", gpt3.CreateImageModelDallE3, "select the image model")
+	cmd.Flags().StringVarP(&ImageSize, "size", "s", gpt3.CreateImageSize1024x1024, "image size, like 1024x1024, sizes depend on the model")
+	cmd.Flags().IntVarP(&ImageCount, "count", "n", 1, "number of images to generate")
+	cmd.Flags().StringVarP(&ImageDir, "output-dir", "o", ".", "directory to save the images in")
+
+	return cmd
+}
+
+// GenerateImages saves ImageCount images for the prompt to ImageDir,
+// named after the prompt, and prints where they were saved
+func GenerateImages(client *gpt3.Client, ctx context.Context, prompt string) error {
+	if ImageCount < 1 {
+		return fmt.Errorf("count must be at least 1")
+	}
+	err := CheckBudget()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(ImageDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	req := gpt3.ImageRequest{
+		Prompt: prompt,
+		Model:  ImageModel,
+		N:      ImageCount,
+		Size:   ImageSize,
+		User:   User,
+	}
+	// gpt-image models always return base64, and refuse the parameter
+	if strings.HasPrefix(ImageModel, "dall-e") {
+		req.ResponseFormat = gpt3.CreateImageResponseFormatB64JSON
+	}
+	// dall-e-3 makes one image per request
+	requests := 1
+	if ImageModel == gpt3.CreateImageModelDallE3 {
+		req.N, requests = 1, ImageCount
+	}
+
+	name := Slugify(prompt)
+	if name == "" {
+		name = "image"
+	}
+	for i := 0; i < requests; i++ {
+		resp, err := client.CreateImage(ctx, req)
+		if err != nil {
+			return err
+		}
+		if price, ok := imagePrices[ImageModel]; ok {
+			RecordCost(price * float64(len(resp.Data)))
+		} else {
+			warnUnpriced(ImageModel)
+		}
+		for _, d := range resp.Data {
+			b, err := base64.StdEncoding.DecodeString(d.B64JSON)
+			if err != nil {
+				return err
+			}
+			path, err := freeName(filepath.Join(ImageDir, name), ".png")
+			if err != nil {
+				return err
+			}
+			err = os.WriteFile(path, b, 0644)
+			if err != nil {
+				return err
+			}
+			fmt.Println(path)
+		}
+	}
+	return nil
+}
+
+// freeName returns base-<n>ext for the first n that is not taken
+func freeName(base, ext string) (string, error) {
+	for n := 1; ; n++ {
+		path := fmt.Sprintf("%s-%d%s", base, n, ext)
+		_, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			return path, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// the largest image the API accepts
+const maxImageSize = 20 << 20
+
+// ImageParts are the --image attachments, sent with the first user message
+var ImageParts []gpt3.ChatMessagePart
+
+// LoadImages reads local images into data URLs, URLs are sent as they are
+func LoadImages(images []string) error {
+	ImageParts = nil
+	for _, img := range images {
+		url := img
+		if !strings.HasPrefix(img, "http://") && !strings.HasPrefix(img, "https://") && !strings.HasPrefix(img, "data:") {
+			b, err := os.ReadFile(img)
+			if err != nil {
+				return err
+			}
+			if len(b) > maxImageSize {
+				return fmt.Errorf("%s is larger than the 20MB the API accepts", img)
+			}
+			mime := http.DetectContentType(b)
+			if !strings.HasPrefix(mime, "image/") {
+				return fmt.Errorf("%s is not an image, it looks like %s", img, mime)
+			}
+			url = "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(b)
+		}
+		ImageParts = append(ImageParts, gpt3.ChatMessagePart{
+			Type:     gpt3.ChatMessagePartTypeImageURL,
+			ImageURL: &gpt3.ChatMessageImageURL{URL: url, Detail: gpt3.ImageURLDetailAuto},
+		})
+	}
+	return nil
+}
+
+// attachImages returns the messages with the images added to the first user message,
+// the conversation keeps only text so it can be rendered and saved
+func attachImages(messages []gpt3.ChatCompletionMessage) []gpt3.ChatCompletionMessage {
+	if len(ImageParts) == 0 {
+		return messages
+	}
+	messages = append([]gpt3.ChatCompletionMessage(nil), messages...)
+	for i, m := range messages {
+		if m.Role != gpt3.ChatMessageRoleUser {
+			continue
+		}
+		parts := []gpt3.ChatMessagePart{{Type: gpt3.ChatMessagePartTypeText, Text: m.Content}}
+		messages[i].MultiContent = append(parts, ImageParts...)
+		messages[i].Content = ""
+		break
+	}
+	return messages
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// the last listings, so they can be selected by number
+var listedModels []string
+var listedPrompts []string
+
+// ModelsCommand lists the models available to the API key,
+// or selects one by its number in the listing
+func ModelsCommand(client *gpt3.Client, ctx context.Context, args []string) error {
+	if len(args) == 0 || len(listedModels) == 0 {
+		models, err := client.ListModels(ctx)
+		if err != nil {
+			return err
+		}
+		listedModels = listedModels[:0]
+		for _, m := range models.Models {
+			listedModels = append(listedModels, m.ID)
+		}
+		sort.Strings(listedModels)
+	}
+
+	if len(args) == 0 {
+		for i, m := range listedModels {
+			fmt.Printf("[%d]: %s (%s)\n", i, m, ModelFamily(m))
+		}
+		return nil
+	}
+
+	i, err := pickListed(args[0], len(listedModels))
+	if err != nil {
+		return err
+	}
+	Model = listedModels[i]
+	fmt.Println("model is now", Model)
+	return nil
+}
+
+// PromptsCommand lists the known prompts, or adds one
+// to the session by its name or number in the listing
+func PromptsCommand(args []string) error {
+	if len(args) == 0 || len(listedPrompts) == 0 {
+		names, err := ListPrompts()
+		if err != nil {
+			return err
+		}
+		listedPrompts = names
+	}
+
+	if len(args) == 0 {
+		for i, p := range listedPrompts {
+			fmt.Printf("[%d]: %s\n", i, p)
+		}
+		return nil
+	}
+
+	name := args[0]
+	if _, err := strconv.Atoi(name); err == nil {
+		i, err := pickListed(name, len(listedPrompts))
+		if err != nil {
+			return err
+		}
+		name = listedPrompts[i]
+	} else if !slices.Contains(listedPrompts, name) {
+		return fmt.Errorf("there is no prompt named %s, see 'prompts'", name)
+	}
+	contents, err := ReadPrompt(name)
+	if err != nil {
+		return err
+	}
+	// the session is already going, only the text is used
+	_, contents, err = SplitFrontMatter(contents)
+	if err != nil {
+		return err
+	}
+
+	Prompt = name
+	Session.Add(SystemMessage(contents))
+	fmt.Println("prompt is now", Prompt)
+	return nil
+}
+
+func pickListed(arg string, n int) (int, error) {
+	i, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 || i >= n {
+		return 0, fmt.Errorf("choice must be between 0 and %d", n-1)
+	}
+	return i, nil
+}
+
+// EditLastCommand opens the last response in $EDITOR and keeps the edited
+// version in the session, nothing is sent to the API
+func EditLastCommand() error {
+	i := len(Session.Messages) - 1
+	for i >= 0 && Session.Messages[i].Role != gpt3.ChatMessageRoleAssistant {
+		i--
+	}
+	if i < 0 {
+		return fmt.Errorf("there is no response to edit yet")
+	}
+
+	edited, err := EditText(Session.Messages[i].Content)
+	if err != nil {
+		return err
+	}
+	Session.Messages[i].Content = strings.TrimSpace(edited)
+	fmt.Println("last response updated")
+	return nil
+}
+
+// EditText lets the user change text in $EDITOR, falling back to vi
+func EditText(text string) (string, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	f, err := os.CreateTemp("", "chatgpt-*.md")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(text)
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// the editor may have arguments, like 'code --wait'
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", editor, err)
+	}
+
+	b, err := os.ReadFile(f.Name())
+	return string(b), err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// APIKeyFile is the --api-key-file
+var APIKeyFile string
+
+// KeyRotation is the --key-rotation, how requests are spread over several keys
+var KeyRotation string
+
+// apiKeys are all the keys found, clientKey is the first
+var apiKeys []string
+var keyIndex atomic.Uint32
+
+// where the key came from, for --show-config
+var apiKeySource string
+
+// genericKey is set when the key came from the --api-key-file or CHATGPT_API_KEY,
+// the places not only meant for an OpenAI key
+var genericKey bool
+
+// DefaultKeyFile is the key file in the chatgpt directory of the user config directory
+func DefaultKeyFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "chatgpt", "key")
+}
+
+// LoadAPIKey finds the API key in the --api-key-file, CHATGPT_API_KEY, OPENAI_API_KEY,
+// the system keyring, or the default key file, in that order. Having none is not an error here,
+// local servers and the other providers may not need it
+func LoadAPIKey() error {
+	if KeyRotation != "failover" && KeyRotation != "round-robin" {
+		return fmt.Errorf("unknown --key-rotation %q, use failover or round-robin", KeyRotation)
+	}
+
+	if APIKeyFile != "" {
+		keys, err := readKeyFile(APIKeyFile)
+		if err != nil {
+			return err
+		}
+		setKeys(keys, "file "+APIKeyFile)
+		genericKey = true
+		return nil
+	}
+
+	for _, env := range []string{"CHATGPT_API_KEY", "OPENAI_API_KEY"} {
+		if keys := splitKeys(os.Getenv(env), ","); len(keys) > 0 {
+			setKeys(keys, envSource(env))
+			genericKey = env == "CHATGPT_API_KEY"
+			return nil
+		}
+	}
+
+	if key := keyringKey("openai"); key != "" {
+		setKeys([]string{key}, "keyring")
+		return nil
+	}
+
+	filename := DefaultKeyFile()
+	if _, err := os.Stat(filename); filename == "" || os.IsNotExist(err) {
+		return nil
+	}
+	keys, err := readKeyFile(filename)
+	if err != nil {
+		return err
+	}
+	setKeys(keys, "file "+filename)
+	return nil
+}
+
+func setKeys(keys []string, source string) {
+	apiKeys, clientKey, apiKeySource = keys, keys[0], source
+	if len(keys) > 1 {
+		apiKeySource += fmt.Sprintf(" (%d keys, %s)", len(keys), KeyRotation)
+	}
+}
+
+// vendorKey is the key of the anthropic or gemini provider, from its variable or keyring entry.
+// Only the --provider also takes a key of the --api-key-file or CHATGPT_API_KEY,
+// so an OpenAI key, or any key for a --fallback, is never sent to another vendor
+func vendorKey(name, env string, primary bool) (string, error) {
+	if key := os.Getenv(env); key != "" {
+		return key, nil
+	}
+	if key := keyringKey(name); key != "" {
+		return key, nil
+	}
+	if primary && genericKey {
+		return clientKey, nil
+	}
+	if primary {
+		return "", fmt.Errorf("--provider %s needs %s, a key from 'chatgpt auth login --provider %s', or CHATGPT_API_KEY", name, env, name)
+	}
+	return "", fmt.Errorf("%s needs %s or a key from 'chatgpt auth login --provider %s'", name, env, name)
+}
+
+// splitKeys splits a list of keys, ignoring blanks and # comments
+func splitKeys(s, sep string) []string {
+	var keys []string
+	for _, k := range strings.Split(s, sep) {
+		k = strings.TrimSpace(k)
+		if k != "" && !strings.HasPrefix(k, "#") {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// readKeyFile reads the keys, one per line, and warns when others can read the file
+func readKeyFile(filename string) ([]string, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	keys := splitKeys(string(b), "\n")
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("the key file %s is empty", filename)
+	}
+	if info, err := os.Stat(filename); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		fmt.Fprintf(os.Stderr, "warning: %s can be read by other users, fix with 'chmod 600 %s'\n", filename, filename)
+	}
+	return keys, nil
+}
+
+// requestKey is the key for the next request, round-robin moves to the next key
+// on every request, failover stays with a key until it is rate limited
+func requestKey() string {
+	if len(apiKeys) < 2 {
+		return clientKey
+	}
+	if KeyRotation == "round-robin" {
+		return apiKeys[(keyIndex.Add(1)-1)%uint32(len(apiKeys))]
+	}
+	return apiKeys[keyIndex.Load()%uint32(len(apiKeys))]
+}
+
+// rotateKey moves on from a rate limited key
+func rotateKey() string {
+	return apiKeys[keyIndex.Add(1)%uint32(len(apiKeys))]
+}
+
+// errNoKey explains the ways to give the key
+func errNoKey() error {
+	return fmt.Errorf("no API key, run 'chatgpt auth login', set CHATGPT_API_KEY or OPENAI_API_KEY, give --api-key-file, or put it in %s\nVisit https://platform.openai.com/account/api-keys to get one\n", DefaultKeyFile())
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// fence languages for the source files that get --line-numbers
+var codeLanguages = map[string]string{
+	".go": "go", ".py": "python", ".js": "javascript", ".ts": "typescript",
+	".jsx": "jsx", ".tsx": "tsx", ".java": "java", ".kt": "kotlin",
+	".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".hpp": "cpp",
+	".cs": "csharp", ".rs": "rust", ".rb": "ruby", ".php": "php",
+	".swift": "swift", ".scala": "scala", ".sh": "bash", ".bash": "bash",
+	".lua": "lua", ".pl": "perl", ".r": "r", ".sql": "sql",
+	".cue": "cue", ".yaml": "yaml", ".yml": "yaml", ".toml": "toml",
+	".html": "html", ".css": "css", ".vim": "vim", ".zig": "zig",
+}
+
+// NumberLines wraps source code in a fenced block with each line numbered,
+// so the model can refer to them. Other files are returned unchanged
+func NumberLines(filename, content string) string {
+	lang, ok := codeLanguages[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		return content
+	}
+
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	// headers are stripped later, but still count as lines of the file
+	var sb strings.Builder
+	start := 0
+	if ParseFileHeaders {
+		for start < len(lines) && strings.HasPrefix(lines[start], headerPrefix) {
+			sb.WriteString(lines[start] + "\n")
+			start++
+		}
+	}
+
+	width := len(fmt.Sprint(len(lines)))
+	sb.WriteString("```" + lang + "\n")
+	for i := start; i < len(lines); i++ {
+		fmt.Fprintf(&sb, "%*d | %s\n", width, i+1, lines[i])
+	}
+	sb.WriteString("```\n")
+	return sb.String()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"github.com/spf13/pflag"
+)
+
+// Logger records requests, retries, and errors for when chatgpt runs inside
+// larger systems. It discards everything unless --log-format or --log-file is set
+var Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// SetupLogging points Logger at --log-file, or stderr, in the --log-format
+func SetupLogging(flags *pflag.FlagSet) error {
+	if !flags.Changed("log-format") && !flags.Changed("log-file") {
+		return nil
+	}
+
+	var w io.Writer = os.Stderr
+	if LogFile != "" && LogFile != "-" {
+		f, err := os.OpenFile(LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		w = f
+	}
+
+	switch LogFormat {
+	case "text":
+		Logger = slog.New(slog.NewTextHandler(w, nil))
+	case "json":
+		Logger = slog.New(slog.NewJSONHandler(w, nil))
+	default:
+		return fmt.Errorf("unknown --log-format %q, use text or json", LogFormat)
+	}
+	return nil
+}
+
+// logRequest records one API request and how long it took
+func logRequest(mode string, start time.Time, err error) {
+	attrs := []any{
+		"mode", mode,
+		"model", Model,
+		"latency_ms", time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err.Error(), "error_type", errorType(err))
+		Logger.Error("request failed", attrs...)
+		return
+	}
+	attrs = append(attrs,
+		"prompt_tokens", LastUsage.PromptTokens,
+		"completion_tokens", LastUsage.CompletionTokens,
+		"total_tokens", LastUsage.TotalTokens,
+	)
+	Logger.Info("request", attrs...)
+}
+
+// errorType names the kind of err, the API's own type when it gave one
+func errorType(err error) string {
+	var apiErr *gpt3.APIError
+	if errors.As(err, &apiErr) && apiErr.Type != "" {
+		return apiErr.Type
+	}
+	var reqErr *gpt3.RequestError
+	if errors.As(err, &reqErr) {
+		return fmt.Sprintf("http_%d", reqErr.HTTPStatusCode)
+	}
+	return fmt.Sprintf("%T", err)
+}
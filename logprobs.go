@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// TokenLogprob is the log probability of one generated token,
+// with the --logprobs most likely tokens at its position
+type TokenLogprob struct {
+	Token   string             `json:"token"`
+	Logprob float64            `json:"logprob"`
+	Top     map[string]float64 `json:"top,omitempty"`
+}
+
+// LastLogprobs are the tokens of the first response to the most recent request
+var LastLogprobs []TokenLogprob
+
+func chatLogprobs(lp *gpt3.LogProbs) []TokenLogprob {
+	if lp == nil {
+		return nil
+	}
+	var r []TokenLogprob
+	for _, c := range lp.Content {
+		t := TokenLogprob{Token: c.Token, Logprob: c.LogProb, Top: map[string]float64{}}
+		for _, top := range c.TopLogProbs {
+			t.Top[top.Token] = top.LogProb
+		}
+		r = append(r, t)
+	}
+	return r
+}
+
+func completionLogprobs(lp gpt3.LogprobResult) []TokenLogprob {
+	var r []TokenLogprob
+	for i, token := range lp.Tokens {
+		t := TokenLogprob{Token: token, Top: map[string]float64{}}
+		if i < len(lp.TokenLogprobs) {
+			t.Logprob = float64(lp.TokenLogprobs[i])
+		}
+		if i < len(lp.TopLogprobs) {
+			for k, v := range lp.TopLogprobs[i] {
+				t.Top[k] = float64(v)
+			}
+		}
+		r = append(r, t)
+	}
+	return r
+}
+
+// PrintLogprobs writes a line per token, with its alternatives from most to least likely
+func PrintLogprobs(w io.Writer, tokens []TokenLogprob) {
+	for _, t := range tokens {
+		alts := make([]string, 0, len(t.Top))
+		for k := range t.Top {
+			alts = append(alts, k)
+		}
+		sort.Slice(alts, func(i, j int) bool { return t.Top[alts[i]] > t.Top[alts[j]] })
+		for i, a := range alts {
+			alts[i] = fmt.Sprintf("%q %.4f", a, t.Top[a])
+		}
+		fmt.Fprintf(w, "%-16q %8.4f  %s\n", t.Token, t.Logprob, strings.Join(alts, ", "))
+	}
+}
@@ -1,17 +1,17 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"embed"
+	"errors"
 	"fmt"
-	"io/fs"
+	"io"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"time"
 
 	gpt3 "github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
@@ -21,26 +21,80 @@ var LongHelp = `
 Chat with ChatGPT in console.
 
 Examples:
-  # start an interactive session
+  # start an interactive session, responses are printed as they are generated
   chatgpt -i
+  chatgpt -i --no-stream   # print each response once it is complete
+
+  # echo the prompt to stderr, so stdout only has responses
+  chatgpt -i --prompt-echo-stderr
+
+  # replay a scripted conversation, then optionally continue it live
+  chatgpt --script turns.txt
+  chatgpt --script turns.txt -i
+  chatgpt --script turns.txt -i --max-turns 10   # stop after 10 exchanges in total
 
   # ask chatgpt for a one-time response
   chatgpt -q "answer me this ChatGPT..."
 
   # provide context to a question or conversation
   chatgpt context.txt -i
+  cat context.txt | chatgpt -i
   chatgpt context.txt -q "answer me this ChatGPT..."
+  chatgpt main.go --line-numbers -q "review this code"
+  chatgpt a.go b.go -q "how do these relate?"      # each file is labeled with '--- name ---'
+  chatgpt part1.txt part2.txt --no-context-separator
 
   # read prompt from file and --write response back
   chatgpt convo.txt
   chatgpt convo.txt --write
+  chatgpt convo.txt --write --dedupe-output  # exit code 3 when nothing new was appended
+
+  # let context files carry their own settings, as leading header lines
+  #   #!chatgpt model=text-curie-001 tokens=1000 question="summarize this"
+  # keys are the request parameters question, model, tokens, temp, topp, pres, freq, stop, count,
+  # seed, json-output, and logit-bias, flags given on the command line still win
+  chatgpt --parse-headers notes.txt
+
+  # process a manifest of {file, instruction, model, output} jobs
+  chatgpt --manifest jobs.yaml
+  chatgpt --manifest jobs.yaml --format csv --fields file,response,cost > results.csv
+  chatgpt --manifest jobs.yaml --format jsonl | jq .response
+  chatgpt --manifest jobs.yaml --resume  # skip entries finished by an interrupted run
+  chatgpt -q "..." --format json --json-compact
+
+  # scrub secrets from logs or config before they are sent
+  chatgpt --redact app.log -q "why did this fail?"
+  chatgpt --redact --redact-rules rules.txt app.log -q "..."
+
+  # keep asking until the response passes a check
+  chatgpt -q "list 3 colors as a JSON array" --until-json --until-feedback
+  chatgpt -q "describe go as name, year, and authors" --json-output | jq .authors
+  chatgpt -q "..." --until-match '^[A-Z]' --max-retries 5
+  chatgpt -q "write a go program" --until 'cat > /tmp/x.go && go vet /tmp/x.go'
 
   # pipe content from another program, useful for ! in vim visual mode
   cat convo.txt | chatgpt
 
+  # ask vision models about images, files or URLs
+  chatgpt -m gpt-4o --image screenshot.png -q "what's wrong in this screenshot?"
+
+  # ask the question before the file contents, instead of after
+  chatgpt --question-position before report.txt -q "summarize what follows"
+
+  # chain invocations, the piped response is the context for the next question
+  # piped output is only the response, as if --quiet were given
+  chatgpt -q "draft an email declining the meeting" | chatgpt -q "make it shorter"
+
+  # files redirected to stdin are only read with --stdin, and --stdin=false ignores a pipe,
+  # like one that is never closed, or the input of a loop
+  chatgpt --stdin -q "summarize this" < report.txt
+  cat files.txt | while read f; do chatgpt --stdin=false -q "describe $f"; done
+
   # inspect the predifined prompts, which set ChatGPT's mood
   chatgpt -p list
   chatgpt -p view:<name>
+  chatgpt -p search:<term>              # case-insensitive, across names and bodies
+  chatgpt -p search:'^As a' --regex
 
   # use a prompts with any of the previous modes
   chatgpt -p optimistic -i
@@ -50,31 +104,224 @@ Examples:
 	# set the directory for custom prompts
   chatgpt -P prompts -p my-prompt -i
 
-  # edit mode
-  chatgpt -e ...
+  # a prompt can start with defaults for model, temp, topp, pres, freq, tokens, stop, count,
+  # seed, and json-output, used over the config when it is chosen, flags given still win
+  #   ---
+  #   model: gpt-4o
+  #   temp: 0.2
+  #   ---
+  #   You are a careful code reviewer.
+  chatgpt -P prompts -p reviewer main.go
+
+  # lay out the prompt for self-hosted completion models
+  chatgpt --prompt-format chatml -p teacher -i
+
+  # edit mode, the context is rewritten as instructed and only the result is printed,
+  # keeping its indentation and trailing newline, e.g. in vim :'<,'>!chatgpt -e -q "..."
+  chatgpt -e -q "convert to a table driven test" < parse_test.go
 
   # code mode
   chatgpt -c ...
 
+  # insert between the context and a suffix, completion models only
+  # e.g. in vim, filter the lines up to the gap with the rest of the file as the suffix
+  chatgpt -m gpt-3.5-turbo-instruct --suffix-file rest.go < head.go
+
   # model options (https://platform.openai.com/docs/api-reference/completions/create)
   chatgpt -T 4096    # set max tokens in reponse  [0,4096]
   chatgpt -C         # clean whitespace before sending
+  chatgpt --n 3      # create 3 responses, numbered [0]: [1]: [2]:
+  chatgpt --n 3 --separator $'\n---\n'   # or separated, for other tools
+  chatgpt --best-of 5 -m gpt-3.5-turbo-instruct  # return the likeliest of 5, billed for all 5
+  chatgpt --logprobs 3  # print each token's log probability and its 3 likeliest alternatives
+  chatgpt --seed 42 -q "..."   # repeatable while the printed system fingerprint is unchanged
+  # ban a token by its id, words are not tokenized, look their ids up for the model
+  # at https://platform.openai.com/tokenizer, ids beyond the model's vocabulary are refused
+  chatgpt -m gpt-4o --logit-bias 19701:-100
   chatgpt -E         # echo back the prompt, useful for vim coding
+  chatgpt --max-lines 40  # truncate printed responses, --write still gets everything
   chatgpt --temp     # set the temperature param  [0.0,2.0]
   chatgpt --topp     # set the TopP param         [0.0,1.0]
+  chatgpt --temperature 0 --top-p 0.1   # the API names work too
+  chatgpt --stop '\n>' -i      # end responses before the model writes the next question
+  chatgpt --frequency-penalty 0.8 --presence-penalty 0.4  # discourage repetition in long responses
+  CHATGPT_TEMPERATURE=0.2 chatgpt -i    # change the defaults, flags still win
   chatgpt --pres     # set the Presence Penalty   [-2.0,2.0]
   chatgpt --freq     # set the Frequency Penalty  [-2.0,2.0]
 
-  # change model selection, available models are listed here:
-  # https://pkg.go.dev/github.com/sashabaranov/go-openai#Client.ListModels
-  chatgpt -m text-davinci-003  # set the model to text-davinci-003 (the default)
-  chatgpt -m text-ada-001      # set the model to text-ada-001
+  # compare the responses of two saved sessions
+  chatgpt sessions diff a.json b.json --markdown
+
+  # ask the last question of a saved session again, replacing the response
+  chatgpt --retry-last chat.json --temp 1.2
+
+  # generate images, saved as PNGs named after the prompt
+  chatgpt image "a lighthouse in a storm, oil painting" -n 2 -o images/
+
+  # transcribe a recording, then ask about it
+  chatgpt transcribe meeting.mp3 -o meeting.txt
+  chatgpt meeting.txt -q "what was decided?"
+  chatgpt transcribe interview.m4a --translate --format srt > subtitles.srt
+
+  # read text aloud, from arguments, stdin, or the last response of a saved session
+  chatgpt speak "hello there" --voice nova --play
+  chatgpt -q "tell me a short story" | chatgpt speak -o story.mp3
+  chatgpt speak --session chat.json --format wav
+
+  # embedding vectors as JSON [{input, embedding}], per file or per line
+  chatgpt embed docs/*.md -o vectors.json
+  cat phrases.txt | chatgpt embed --lines | jq '.[0].embedding | length'
+
+  # train a custom model on a jsonl of example chats, then use it
+  chatgpt finetune create train.jsonl --suffix support
+  chatgpt finetune list
+  chatgpt finetune status ftjob-abc123
+  chatgpt -m ft:gpt-4o-mini-2024-07-18:org:support:abc123 -i
+
+  # measure endpoint latency and throughput
+  chatgpt bench -n 50 -j 5 --stream
+
+  # keep the API key in the system keyring, instead of a shell rc file
+  chatgpt auth login
+  pass show openai | chatgpt auth login
+  chatgpt auth login --provider anthropic
+
+  # replace the key in the keyring or key file, only once the API accepts the new one,
+  # then check the old key is refused after revoking it
+  chatgpt auth rotate
+  chatgpt auth rotate --key-file new-key.txt --check-old
+
+  # variables are also read from .env in the working directory and ~/.chatgpt.env,
+  # without replacing those already set
+  printf 'CHATGPT_API_KEY=sk-...\nCHATGPT_MODEL=gpt-4o\n' > .env
+
+  # spread a batch over several keys, the next key is used when one is rate limited,
+  # or every request takes the next with round-robin
+  export CHATGPT_API_KEY=sk-one,sk-two,sk-three
+  chatgpt bench -n 200 -j 8 --key-rotation round-robin
+
+  # bill to one of the organizations and projects of your key, or keep them in the config
+  chatgpt --org org-abc123 --project proj_abc123 -q "..."
+  chatgpt config set org org-abc123
+
+  # keep spending in check, costs are estimated from token usage and known prices,
+  # a warning comes at 80% of a budget, and requests are refused once it is spent
+  chatgpt config set budget-daily 2
+  chatgpt config set budget-monthly 20
+  chatgpt --force -q "..."
+
+  # give up when the API does not answer within a minute, instead of waiting indefinitely
+  chatgpt --timeout 1m -q "..."
+
+  # rate limits, server errors, and dropped connections are retried with growing waits,
+  # 3 times by default, or not at all
+  chatgpt --request-retries 8 -q "..."
+  chatgpt --request-retries 0 -q "..."
+
+  # reach the API through a corporate or SOCKS proxy, HTTPS_PROXY and ALL_PROXY are used too
+  chatgpt --proxy http://proxy.corp:3128 -q "..."
+  chatgpt --proxy socks5://localhost:1080 -i
+
+  # trust the certificate of a TLS-intercepting proxy, or present a client certificate to a gateway
+  chatgpt --ca-cert ~/corp-root.pem -q "..."
+  chatgpt --client-cert me.pem --client-key me-key.pem --api-base https://gateway.corp/v1 -q "..."
+
+  # send extra headers a gateway needs, also kept in the config as
+  #   header: ["X-Team: search", "X-Route: eu"]
+  chatgpt --header "X-Team: search" --header "X-Route: eu" -q "..."
+
+  # send the API key the way a gateway expects it
+  chatgpt --auth-header api-key --auth-scheme "" -q "..."
+  chatgpt --auth-query key -q "..."
+
+  # change model selection, list the models your key can use with their family
+  # (chat, completion, reasoning, edit, embedding, or other)
+  chatgpt models
+  # chat models get the session as system, user, and assistant messages
+  chatgpt -m gpt-3.5-turbo     # set the model to gpt-3.5-turbo (the default)
+  chatgpt -m gpt-4             # set the model to gpt-4
+  chatgpt -m text-davinci-003  # completion models get it as one prompt, see --prompt-format
+  chatgpt -e -m code-davinci-edit-001 ...  # -e takes chat models, or the retired edit models
+  CHATGPT_MODEL=gpt-4 chatgpt -i           # change the default, --model still wins
+
+  # every flag has a variable, CHATGPT_ and the name in upper case, for CI and containers
+  CHATGPT_TOKENS=2048 CHATGPT_PRETEXT=coding CHATGPT_NO_STREAM=true chatgpt -q "..."
+
+  # let chat models call tools, results are sent back until the model answers
+  chatgpt --tools -i
+  chatgpt --tools-file tools.yaml -q "what is the weather in Paris?"
+  #   - name: weather
+  #     description: Get the current weather for a city
+  #     parameters: {type: object, properties: {city: {type: string}}, required: [city]}
+  #     command: jq -r .city | xargs -I{} curl -s 'wttr.in/{}?format=3'
+
+  # check questions with the moderation endpoint before they are sent
+  chatgpt --moderate -i
+  chatgpt --moderate=warn --moderate-categories hate,violence -q "..."
+  chatgpt moderate "some text"   # exits with code 2 when flagged
+
+  # talk to an assistant, its thread is kept on the server and picked up on the next run
+  chatgpt --assistant asst_abc123 -i
+  chatgpt --assistant asst_abc123 --attach sales.csv --code-interpreter -q "plot monthly totals"
+  chatgpt --assistant asst_abc123 --new-thread -q "let's start over"
+
+  # keep defaults in the config file, as long flag names, flags given still win
+  printf 'model: gpt-4o\ntokens: 2048\npretext: coding\n' > ~/.config/chatgpt/config.yaml
+
+  # or change them with validation, instead of editing the yaml
+  chatgpt config set model gpt-4o
+  chatgpt config set stop "###" "END"
+  chatgpt config get
+  chatgpt config edit
+
+  # profiles bundle settings under a name, in the config file as
+  #   profiles:
+  #     cheap: {model: gpt-4o-mini, tokens: 256}
+  #     work: {provider: azure, model: gpt-4o, temp: 0.2, pretext: coding}
+  chatgpt --profile work -q "review this" main.go
+  chatgpt config set --profile cheap model gpt-4o-mini
+
+  # aliases name models, and are used wherever a model is given, in the config file as
+  #   aliases: {fast: gpt-4o-mini, smart: gpt-4o}
+  chatgpt -m fast -q "..."
+  chatgpt --fallback anthropic:claude-3-5-haiku-latest -m smart -i
+
+  # a .chatgpt.yaml in the project, or a parent directory, is used over the config file,
+  # it only sets what is asked and how, with relative paths inside the project,
+  # not where requests go, commands to run, or files to write
+  printf 'pretext: coding\ncontext: [docs/ARCHITECTURE.md]\n' > .chatgpt.yaml
+
+  # use a local OpenAI-compatible server, no key is needed when it does not check one
+  chatgpt --api-base http://localhost:11434/v1 --model llama3 -i
+
+  # use Claude, with the key in ANTHROPIC_API_KEY
+  chatgpt --provider anthropic --model claude-3-5-sonnet-latest -i
+
+  # use Gemini, with the key in GEMINI_API_KEY
+  chatgpt --provider gemini --model gemini-1.5-flash -i
+
+  # when OpenAI fails or is rate limited, retry with Claude and then Gemini
+  chatgpt --model gpt-4o --fallback anthropic:claude-3-5-haiku-latest --fallback gemini:gemini-1.5-flash -q "hello"
+
+  # use an Azure OpenAI resource, the key in CHATGPT_API_KEY is sent in the api-key header
+  chatgpt --provider azure --azure-endpoint https://NAME.openai.azure.com --azure-deployment gpt4o -q "hello"
+
+  # record responses by prompt hash and replay them on later runs, for demos and golden tests
+  # this only makes the tool repeatable, the live API is still not deterministic
+  chatgpt --replay testdata/recorded -q "..."
+  chatgpt --replay testdata/recorded --replay-only -q "..."
+
+  # attribute usage on a shared key to each person, set once in a shell profile
+  export CHATGPT_USER=alice@example.com
+
+  # structured logs of requests (model, latency, tokens), retries, and errors
+  chatgpt --log-format json --log-file chatgpt.log -q "..."
 
 `
 
-var interactiveHelp = `starting interactive session...
-  'quit' to exit
-  'save <filename>' to preserve
+var interactiveHelp = `  'quit' to exit
+  'save <filename>' to preserve, as messages when it ends in .json
+  'save'             with no filename, to <generated-title>.json
   'tokens' to change the MaxToken param
   'count' to change number of responses
   'temp'  set the temperature param  [0.0,2.0]
@@ -82,100 +329,324 @@ var interactiveHelp = `starting interactive session...
   'pres'  set the Presence Penalty   [-2.0,2.0]
   'freq'  set the Frequency Penalty  [-2.0,2.0]
   'model' to change the selected model
+  'models [n]'  list available models, or select one by number
+  'prompts [n]' list prompts, or add one to the session by number or name, also 'pretext <name>'
+  'undo'        take back the last question and its response, the rest of the conversation stays
+  'reset'       forget the conversation, back to how the session started
+  'regen [temp]' ask the last question again for a new response, at another temperature if given, also 'retry'
+  'help'        show these commands, any of which can start with a '/', as in '/model gpt-4o'
+  'edit-last'   change the last response in $EDITOR before the next question
+  'speak'       read the last response aloud, see 'chatgpt speak -h' for voices
+  '@path'       in a question, include the file(s), globs are allowed
+  '"""'         on a line of its own, starts and ends a question of several lines,
+                as does a backslash at the end of a line
 `
 
 //go:embed prompts/*
 var predefined embed.FS
 
 var Version bool
+var NoUpdateCheck bool
+var ShowConfig bool
 
 // prompt vars
 var Question string
+var QuestionStdin bool
 var Prompt string
 var PromptDir string
 var PromptMode bool
+var Script string
+var SearchRegex bool
 var EditMode bool
 var CodeMode bool
 var CleanPrompt bool
 var WriteBack bool
-var PromptText string
+var DedupeOutput bool
+var Manifest string
+var Resume bool
+var PromptEchoStderr bool
+var ForceUTF8 bool
+var ParseFileHeaders bool
+var LineNumbers bool
+var ContextFiles []string
+var ContextSeparator string
+var NoContextSeparator bool
+var RedactPrompt bool
+var RedactRules string
+var PromptText string // the pretext, before the Session starts
+var PromptFormat string
+var NoAutoTitle bool
+var MaxTurns int
+var QuestionPosition string
+var Suffix string
+var SuffixFile string
+var Images []string
+var NoStream bool
 
 // chatgpt vars
 var MaxTokens int
 var Count int
+var Separator string
+var BestOf int
+var Logprobs int
+var Seed int
+var Seeded bool // when --seed was given
+var LogitBiasFlags []string
+var LogitBias map[string]int // from LogitBiasFlags
 var Echo bool
+var MaxLines int
+var Stop []string
 var Temp float64
 var TopP float64
 var PresencePenalty float64
 var FrequencyPenalty float64
 var Model string
+var User string
+var StrictParams bool
+var ReplayDir string
+var ReplayOnly bool
+var Moderation string
+var ModerateCategories []string
+
+// connection vars
+var AuthHeader string
+var AuthScheme string
+var AuthQuery string
+var KeepAlive time.Duration
+var ProviderName string
+var APIBase string
+var AzureEndpoint string
+var AzureDeployment string
+var AzureAPIVersion string
+var OrgID string
+var ProjectID string
+var Warm bool
+var Proxy string
+var Headers []string
+var CACert string
+var ClientCert string
+var ClientKey string
+var Insecure bool
+var Timeout time.Duration
+
+// validation vars
+var UntilCommand string
+var UntilJSON bool
+var UntilMatch string
+var UntilFeedback bool
+var JSONOutput bool
+var MaxRetries int
+
+// tool vars
+var ToolsBuiltin bool
+var ToolsFile string
+
+// assistant vars
+var AssistantID string
+var ThreadID string
+var NewThread bool
+var Attachments []string
+var CodeInterpreter bool
+
+// output vars
+var OutputFormat string
+var OutputFields string
+var JSONIndent bool
+var JSONCompact bool
+var Quiet bool
+var LogFormat string
+var LogFile string
 
 // internal vars
+var LastUsage gpt3.Usage   // of the most recent request
+var LastModel string       // that answered it, which is a fallback after a failover
+var LastFingerprint string // the backend configuration that served it, for --seed
+var turnsTaken int         // exchanges in this session, for --max-turns
+var turnUsage gpt3.Usage   // summed over those exchanges
+
 func init() {
 }
 
+// Chatting reports whether the model takes messages through the chat endpoint
+func Chatting() bool {
+	if CodeMode {
+		return false
+	}
+	family := ModelFamily(Model)
+	return family == "chat" || family == "reasoning"
+}
 
-
-/*
-func GetChatCompletionResponse(client *gpt3.Client, ctx context.Context, question string) ([]string, error) {
+// newChatRequest sends the conversation as messages, keeping their roles
+func newChatRequest(messages []gpt3.ChatCompletionMessage, opts ChatOptions) gpt3.ChatCompletionRequest {
 	if CleanPrompt {
-		question = strings.ReplaceAll(question, "\n", " ")
-		question = strings.ReplaceAll(question, "  ", " ")
-	}
-	// insert newline at end to prevent completion of question
-	if !strings.HasSuffix(question, "\n") {
-		question += "\n"
+		messages = append([]gpt3.ChatCompletionMessage(nil), messages...)
+		for i := range messages {
+			messages[i].Content = cleanText(messages[i].Content)
+		}
 	}
 
 	req := gpt3.ChatCompletionRequest{
 		Model:            Model,
-		MaxTokens:        MaxTokens,
-		Prompt:           question,
-		Echo:             Echo,
-		N:                Count,
+		Messages:         attachImages(messages),
+		MaxTokens:        opts.MaxTokens,
+		N:                opts.Count,
 		Temperature:      float32(Temp),
 		TopP:             float32(TopP),
 		PresencePenalty:  float32(PresencePenalty),
 		FrequencyPenalty: float32(FrequencyPenalty),
+		Stop:             Stop,
+		LogitBias:        LogitBias,
+		Seed:             seedParam(),
+		User:             User,
+	}
+	if Logprobs > 0 {
+		req.LogProbs, req.TopLogProbs = true, Logprobs
+	}
+	if JSONOutput {
+		req.ResponseFormat = &gpt3.ChatCompletionResponseFormat{Type: gpt3.ChatCompletionResponseFormatTypeJSONObject}
+		// the API refuses JSON mode unless the messages ask for JSON
+		if !mentionsJSON(messages) {
+			req.Messages = append(append([]gpt3.ChatCompletionMessage(nil), messages...), SystemMessage("Respond with JSON."))
+		}
 	}
-	resp, err := client.CreateChatCompletion(ctx, req)
+	// reasoning models count their hidden reasoning against a separate limit, and
+	// refuse sampling parameters, even the defaults and those set before a /model
+	if ModelFamily(Model) == "reasoning" {
+		req.MaxTokens, req.MaxCompletionTokens = 0, opts.MaxTokens
+		req.Temperature, req.TopP, req.PresencePenalty, req.FrequencyPenalty = 0, 0, 0, 0
+		req.Stop, req.LogitBias, req.LogProbs, req.TopLogProbs = nil, nil, false, 0
+	}
+	return req
+}
+
+// GetChatCompletionResponse sends the messages to the ChatProvider, failing over to the fallbacks
+func GetChatCompletionResponse(ctx context.Context, messages []gpt3.ChatCompletionMessage) (R []string, err error) {
+	err = withFailover(ctx, func(p Provider) error {
+		R, err = p.Chat(ctx, messages, chatFlags())
+		return err
+	})
+	return R, err
+}
+
+// GetResponse sends the conversation to the endpoint for the current mode,
+// as messages to chat models and rendered to a prompt for the others.
+// The question is only used as the instruction in edit mode
+func GetResponse(client *gpt3.Client, ctx context.Context, conv *Conversation, question string) ([]string, error) {
+	c := conv.Copy()
+	if RedactPrompt {
+		c.Redact()
+		question = Redact(question)
+	}
+	LastUsage = gpt3.Usage{}
+	LastModel = Model
+	LastLogprobs = nil
+	LastFingerprint = ""
+	if ReplayDir != "" {
+		return GetReplayResponse(client, ctx, &c, question)
+	}
+	return getLiveResponse(client, ctx, &c, question)
+}
+
+func getLiveResponse(client *gpt3.Client, ctx context.Context, conv *Conversation, question string) (R []string, err error) {
+	err = CheckBudget()
 	if err != nil {
 		return nil, err
 	}
-
-	var r []string
-	for _, c := range resp.Choices {
-		r = append(r, c.Text)
+	defer func() { RecordSpend(LastModel, LastUsage) }()
+
+	start := time.Now()
+	if AssistantID != "" {
+		R, err = GetAssistantResponse(client, ctx, conv)
+		logRequest("assistant", start, err)
+	} else if CodeMode {
+		R, err = GetCodeResponse(client, ctx, conv.Render(true))
+		logRequest("code", start, err)
+	} else if EditMode && Chatting() {
+		R, err = GetChatEditResponse(ctx, conv, question)
+		logRequest("edit", start, err)
+	} else if EditMode {
+		R, err = GetEditsResponse(client, ctx, conv.Render(true), question)
+		logRequest("edit", start, err)
+	} else if Chatting() && len(Tools) > 0 {
+		R, err = GetToolResponse(client, ctx, conv.Messages)
+		logRequest("tools", start, err)
+	} else if Chatting() {
+		R, err = GetChatCompletionResponse(ctx, conv.Messages)
+		logRequest("chat", start, err)
+	} else {
+		R, err = GetCompletionResponse(client, ctx, conv.Render(true))
+		logRequest("completion", start, err)
 	}
-	return r, nil
+	return R, err
 }
-*/
 
-func GetCompletionResponse(client *gpt3.Client, ctx context.Context, question string) ([]string, error) {
+// cleanText removes the excess whitespace for --clean
+func cleanText(text string) string {
+	text = strings.ReplaceAll(text, "\n", " ")
+	return strings.ReplaceAll(text, "  ", " ")
+}
+
+// newCompletionRequest applies the prompt cleanups and model parameters
+func newCompletionRequest(model, question string) gpt3.CompletionRequest {
 	if CleanPrompt {
-		question = strings.ReplaceAll(question, "\n", " ")
-		question = strings.ReplaceAll(question, "  ", " ")
+		question = cleanText(question)
 	}
-	// insert newline at end to prevent completion of question
-	if !strings.HasSuffix(question, "\n") {
+	// insert newline at end to prevent completion of question,
+	// unless the completion is being inserted before a suffix
+	if PromptFormat == "openai" && Suffix == "" && !strings.HasSuffix(question, "\n") {
 		question += "\n"
 	}
 
-	req := gpt3.CompletionRequest{
-		Model:            Model,
+	return gpt3.CompletionRequest{
+		Model:            model,
 		MaxTokens:        MaxTokens,
 		Prompt:           question,
 		Echo:             Echo,
 		N:                Count,
+		BestOf:           BestOf,
 		Temperature:      float32(Temp),
 		TopP:             float32(TopP),
 		PresencePenalty:  float32(PresencePenalty),
 		FrequencyPenalty: float32(FrequencyPenalty),
+		Stop:             Stop,
+		LogProbs:         Logprobs,
+		LogitBias:        LogitBias,
+		Suffix:           Suffix,
+		Seed:             seedParam(),
+		User:             User,
 	}
+}
+
+func mentionsJSON(messages []gpt3.ChatCompletionMessage) bool {
+	for _, m := range messages {
+		if strings.Contains(strings.ToLower(m.Content), "json") {
+			return true
+		}
+	}
+	return false
+}
+
+// seedParam leaves the seed out of requests unless --seed was given
+func seedParam() *int {
+	if !Seeded {
+		return nil
+	}
+	seed := Seed
+	return &seed
+}
+
+func GetCompletionResponse(client *gpt3.Client, ctx context.Context, question string) ([]string, error) {
+	req := newCompletionRequest(Model, question)
 	resp, err := client.CreateCompletion(ctx, req)
 	if err != nil {
 		return nil, err
 	}
+	if resp.Usage != nil {
+		LastUsage = *resp.Usage
+	}
+	if len(resp.Choices) > 0 {
+		LastLogprobs = completionLogprobs(resp.Choices[0].LogProbs)
+	}
 
 	var r []string
 	for _, c := range resp.Choices {
@@ -203,6 +674,7 @@ func GetEditsResponse(client *gpt3.Client, ctx context.Context, input, instructi
 	if err != nil {
 		return nil, err
 	}
+	LastUsage = resp.Usage
 
 	var r []string
 	for _, c := range resp.Choices {
@@ -212,30 +684,14 @@ func GetEditsResponse(client *gpt3.Client, ctx context.Context, input, instructi
 }
 
 func GetCodeResponse(client *gpt3.Client, ctx context.Context, question string) ([]string, error) {
-	if CleanPrompt {
-		question = strings.ReplaceAll(question, "\n", " ")
-		question = strings.ReplaceAll(question, "  ", " ")
-	}
-	// insert newline at end to prevent completion of question
-	if !strings.HasSuffix(question, "\n") {
-		question += "\n"
-	}
-
-	req := gpt3.CompletionRequest{
-		Model:            gpt3.CodexCodeDavinci002,
-		MaxTokens:        MaxTokens,
-		Prompt:           question,
-		Echo:             Echo,
-		N:                Count,
-		Temperature:      float32(Temp),
-		TopP:             float32(TopP),
-		PresencePenalty:  float32(PresencePenalty),
-		FrequencyPenalty: float32(FrequencyPenalty),
-	}
+	req := newCompletionRequest(gpt3.CodexCodeDavinci002, question)
 	resp, err := client.CreateCompletion(ctx, req)
 	if err != nil {
 		return nil, err
 	}
+	if resp.Usage != nil {
+		LastUsage = *resp.Usage
+	}
 
 	var r []string
 	for _, c := range resp.Choices {
@@ -277,56 +733,79 @@ func (NullWriter) Write([]byte) (int, error) { return 0, nil }
 
 func main() {
 
-	apiKey := os.Getenv("CHATGPT_API_KEY")
-	if apiKey == "" {
-		fmt.Println("CHATGPT_API_KEY environment var is missing\nVisit https://platform.openai.com/account/api-keys to get one\n")
-		os.Exit(1)
-	}
-
-	if PromptDir == "" {
-		if v := os.Getenv("CHATGPT_PROMPT_DIR"); v != "" {
-			PromptDir = v
-		}
-	}
-
-	client := gpt3.NewClient(apiKey)
+	// the key and provider are set up once flags are parsed
+	client := NewClient()
 
 	rootCmd := &cobra.Command{
-		Use:   "chatgpt [file]",
+		Use:   "chatgpt [file...]",
 		Short: "Chat with ChatGPT in console.",
 		Long:  LongHelp,
+		// subcommands would otherwise reject the context file argument
+		Args: cobra.ArbitraryArgs,
 		Run: func(cmd *cobra.Command, args []string) {
 			if Version {
 				printVersion()
 				os.Exit(0)
 			}
+			err := SetupLogging(cmd.Flags())
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			// keep chained invocations to just their responses
+			if !cmd.Flags().Changed("quiet") && StdoutPiped() {
+				Quiet = true
+			}
+
+			if !NoUpdateCheck && !Quiet {
+				CheckForUpdate()
+			}
 
-			var err error
 			var filename string
 
-			// We build up PromptText as we go, based on flags
+			if QuestionPosition != "before" && QuestionPosition != "after" {
+				fmt.Printf("unknown --question-position %q, use before or after\n", QuestionPosition)
+				os.Exit(1)
+			}
+
+			if _, ok := promptFormats[PromptFormat]; !ok {
+				fmt.Printf("unknown --prompt-format %q, use one of %s\n", PromptFormat, strings.Join(PromptFormatNames(), ", "))
+				os.Exit(1)
+			}
+
+			if RedactPrompt {
+				err = LoadRedactRules(RedactRules)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
+
+			// We build up the pretext in PromptText as we go, based on flags,
+			// then start the Session with it, the context, and the question
 
 			// Handle the prompt flag
 			if Prompt != "" {
-				var files []fs.DirEntry
-
-				if PromptDir == "" {
-					files, err = predefined.ReadDir("prompts")
-					if err != nil {
-						panic(err)
-					}
-				} else {
-					files, err = os.ReadDir(PromptDir)
+				// list and exit
+				if Prompt == "list" {
+					names, err := ListPrompts()
 					if err != nil {
 						fmt.Println(err)
 						os.Exit(1)
 					}
+					for _, name := range names {
+						fmt.Println(name)
+					}
+					os.Exit(0)
 				}
 
-				// list and exit
-				if Prompt == "list" {
-					for _, f := range files {
-						fmt.Println(strings.TrimSuffix(f.Name(), ".txt"))
+				// search and exit
+				if strings.HasPrefix(Prompt, "search:") {
+					err = SearchPrompts(strings.TrimPrefix(Prompt, "search:"))
+					if err != nil {
+						fmt.Println(err)
+						os.Exit(1)
 					}
 					os.Exit(0)
 				}
@@ -339,12 +818,7 @@ func main() {
 				}
 
 				// read prompt pretext
-				var contents []byte
-				if PromptDir == "" {
-					contents, err = predefined.ReadFile("prompts/" + Prompt + ".txt")
-				} else {
-					contents, err = os.ReadFile(filepath.Join(PromptDir, Prompt + ".txt"))
-				}
+				contents, err := ReadPrompt(Prompt)
 				if err != nil {
 					fmt.Println(err)
 					os.Exit(1)
@@ -353,10 +827,20 @@ func main() {
 				// print and exit or...
 				// prime prompt with known pretext
 				if viewMode {
-					fmt.Println(string(contents))
+					fmt.Println(contents)
 					os.Exit(0)
 				} else {
-					PromptText = string(contents)
+					settings, text, err := SplitFrontMatter(contents)
+					if err != nil {
+						err = fmt.Errorf("prompt %s: %w", Prompt, err)
+					} else {
+						err = SetPromptDefaults(cmd.Flags(), Prompt, settings)
+					}
+					if err != nil {
+						fmt.Println(err)
+						os.Exit(1)
+					}
+					PromptText = text
 				}
 
 				// prime prompt with custom pretext
@@ -366,47 +850,206 @@ func main() {
 
 			}
 
+			switch OutputFormat {
+			case "text", "csv", "json", "jsonl":
+			default:
+				fmt.Printf("unknown --format %q, use text, csv, json, or jsonl\n", OutputFormat)
+				os.Exit(1)
+			}
+
+			// structured output carries the logprobs as a field
+			if Logprobs > 0 && !cmd.Flags().Changed("fields") {
+				OutputFields += ",logprobs"
+			}
+
+			// process each manifest entry with its own file and instruction
+			if Manifest != "" {
+				err = RunManifest(client, Manifest)
+				if err != nil {
+					PrintError(err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			var contextText string
+
+			// a question only reads from a pipe, unless --stdin says otherwise, so
+			// one run inside a 'while read' loop does not swallow the loop's input
+			questionStdin := StdinFIFO()
+			if cmd.Flags().Changed("stdin") {
+				questionStdin = QuestionStdin
+			}
+
 			// no args, interactive, or question... read from stdin
-			// this is mainly for replacing text in vim
-			if len(args) == 0 && !PromptMode && Question == "" {
-				reader := bufio.NewReader(os.Stdin)
-				var buf bytes.Buffer
-				for {
-					b, err := reader.ReadByte()
-					if err != nil {
-						break
-					}
-					buf.WriteByte(b)
+			// this is mainly for replacing text in vim, piped stdin is also
+			// the context for a question, so invocations can be chained
+			if len(args) == 0 && !PromptMode && Script == "" && (Question == "" || questionStdin) {
+				contextText, err = ReadStdin()
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			} else if len(args) == 0 && PromptMode && StdinPiped() {
+				// piped context for an interactive session, which then reads from the terminal
+				contextText, err = ReadStdin()
+				if err == nil {
+					err = ReopenTTY()
 				}
-				PromptText += buf.String()
-			} else if len(args) == 1 {
-				// if we have an arg, add it to the prompt
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			} else if len(args) > 0 {
+				// if we have args, add them to the prompt,
+				// responses are written back to the first
 				filename = args[0]
-				content, err := os.ReadFile(filename)
+				contextText, err = ReadContextFiles(append(ContextFiles, args...), cmd.Flags())
 				if err != nil {
 					fmt.Println(err)
 					return
 				}
-				PromptText += string(content)
+			}
+
+			// apply and strip settings in piped context
+			if ParseFileHeaders && len(args) == 0 {
+				contextText, err = ParseHeaders(contextText, cmd.Flags())
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
+
+			// the --context files come before piped context, file arguments were read with them
+			if len(ContextFiles) > 0 && len(args) == 0 {
+				text, err := ReadContextFiles(ContextFiles, cmd.Flags())
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				if contextText != "" {
+					text = strings.TrimRight(text, "\n") + "\n\n" + contextText
+				}
+				contextText = text
+			}
+
+			err = ValidateModel(Model)
+			if err == nil {
+				err = CheckRanges()
+			}
+			if err == nil {
+				Stop, err = ParseStops(Stop)
+			}
+			if err == nil {
+				LogitBias, err = ParseLogitBias(LogitBiasFlags, Model)
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			Seeded = cmd.Flags().Changed("seed") || SettingSources["seed"] != ""
+
+			if Moderation != "" && Moderation != "warn" && Moderation != "refuse" {
+				fmt.Printf("unknown --moderate %q, use warn or refuse\n", Moderation)
+				os.Exit(1)
+			}
+
+			// JSON mode is checked like --until-json, with one retry by default
+			if JSONOutput {
+				UntilJSON = true
+				if !cmd.Flags().Changed("max-retries") && SettingSources["max-retries"] == "" {
+					MaxRetries = 1
+				}
+			}
+
+			// drop parameters the model will reject
+			err = CheckParams(cmd.Flags())
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			err = LoadImages(Images)
+			if err == nil {
+				err = LoadTools(ToolsBuiltin, ToolsFile)
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			// the text after the insertion, for fill-in-the-middle
+			if SuffixFile != "" {
+				Suffix, err = ReadContextFile(SuffixFile)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
+
+			if ShowConfig {
+				PrintConfig(cmd.Flags())
+				os.Exit(0)
+			}
+
+			// a saved session is asked again instead of starting one
+			if RetryLast != "" {
+				err = RetryLastSession(client, RetryLast)
+				if err != nil {
+					PrintError(err)
+					os.Exit(1)
+				}
+				return
 			}
 
 			// if there is a question, it comes last in the prompt
-			if Question != "" && !EditMode {
-				PromptText += "\n" + Question
+			question := ""
+			if !EditMode {
+				question = Question
+			}
+			Session = NewConversation(PromptText, contextText, question)
+
+			// a script runs first, then interactive mode if requested
+			if Script != "" && PromptMode {
+				var quit bool
+				quit, err = runScriptFile(client, Script)
+				if err == nil && !quit {
+					err = RunPrompt(client)
+				}
+				if err != nil {
+					PrintError(err)
+					os.Exit(1)
+				}
+				return
 			}
 
 			// interactive or file mode
 			if PromptMode {
-				fmt.Println(interactiveHelp)
-				fmt.Println(PromptText)
+				// keep stdout for responses only when requested
+				echo := os.Stdout
+				if PromptEchoStderr {
+					echo = os.Stderr
+				}
+				if Warm {
+					Warmup()
+				}
+				fmt.Fprintln(echo, "starting interactive session...")
+				fmt.Fprintln(echo, interactiveHelp)
+				fmt.Fprintln(echo, Session.Render(false))
 				err = RunPrompt(client)
+			} else if Script != "" {
+				err = RunScript(client, Script)
 			} else {
 				// empty filename (no args) prints to stdout
 				err = RunOnce(client, filename)
 			}
 
+			if errors.Is(err, ErrNoChange) {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(3)
+			}
 			if err != nil {
-				fmt.Println(err)
+				PrintError(err)
 				os.Exit(1)
 			}
 
@@ -414,58 +1057,310 @@ func main() {
 	}
 
 	// setup flags
+	rootCmd.Flags().SetNormalizeFunc(NormalizeFlag)
 	rootCmd.Flags().BoolVarP(&Version, "version", "", false, "print version information")
+	rootCmd.Flags().BoolVarP(&ShowConfig, "show-config", "", false, "print the effective settings and where each came from, then exit")
+	rootCmd.Flags().BoolVarP(&NoUpdateCheck, "no-update-check", "", false, "do not check GitHub for a newer release (checked at most daily)")
 
 	// prompt releated
 	rootCmd.Flags().StringVarP(&Question, "question", "q", "", "ask a single question and print the response back")
-	rootCmd.Flags().StringVarP(&Prompt, "prompt", "p", "", "prompt to add to ChatGPT input, use 'list' or 'view:<name>' to inspect predefined, '<name>' to use a prompt, or otherwise supply any custom text")
+	rootCmd.Flags().BoolVarP(&QuestionStdin, "stdin", "", false, "with -q, read stdin as context, by default only a pipe from another command is read, --stdin=false ignores it")
+	rootCmd.Flags().StringVarP(&Prompt, "prompt", "p", "", "prompt to add to ChatGPT input, use 'list', 'view:<name>', or 'search:<term>' to inspect predefined, '<name>' to use a prompt, or otherwise supply any custom text")
+	rootCmd.Flags().BoolVarP(&SearchRegex, "regex", "", false, "treat the term in 'search:<term>' as a regular expression")
 	rootCmd.Flags().StringVarP(&PromptDir, "prompt-dir", "P", "", "directory containing custom prompts, if not set the embedded defaults are used")
 	rootCmd.Flags().BoolVarP(&PromptMode, "interactive", "i", false, "start an interactive session with ChatGPT")
-	rootCmd.Flags().BoolVarP(&EditMode, "edit", "e", false, "request an edit with ChatGPT")
+	rootCmd.Flags().StringVarP(&RetryLast, "retry-last", "", "", "ask the last question of a saved session again, replacing the response in the file, give --temp for a different one")
+	rootCmd.Flags().StringVarP(&Script, "script", "", "", "run each line of this file as a turn of an interactive session, add -i to continue live afterwards")
+	rootCmd.Flags().BoolVarP(&EditMode, "edit", "e", false, "edit the context as -q instructs, printing only the edited text")
 	rootCmd.Flags().BoolVarP(&CodeMode, "code", "c", false, "request code completion with ChatGPT")
 	rootCmd.Flags().BoolVarP(&CleanPrompt, "clean", "x", false, "remove excess whitespace from prompt before sending")
 	rootCmd.Flags().BoolVarP(&WriteBack, "write", "w", false, "write response to end of context file")
+	rootCmd.Flags().StringVarP(&UntilCommand, "until", "", "", "retry until this shell command exits 0, given the response on stdin")
+	rootCmd.Flags().BoolVarP(&UntilJSON, "until-json", "", false, "retry until the response is valid JSON")
+	rootCmd.Flags().StringVarP(&UntilMatch, "until-match", "", "", "retry until the response matches this regex")
+	rootCmd.Flags().BoolVarP(&JSONOutput, "json-output", "", false, "ask chat models for a JSON object and retry once if the response does not parse, like --until-json")
+	rootCmd.Flags().BoolVarP(&UntilFeedback, "until-feedback", "", false, "add the validation failure to the prompt for the next attempt")
+	rootCmd.Flags().IntVarP(&MaxRetries, "max-retries", "", 3, "maximum number of retries of responses failing --until, --until-json, or --until-match")
+	rootCmd.Flags().BoolVarP(&Quiet, "quiet", "", false, "hide progress notes on stderr, the default when stdout is piped, warnings and errors are still shown")
+	rootCmd.Flags().StringVarP(&LogFormat, "log-format", "", "text", "log requests, retries, and errors as text or json, logging is off unless this or --log-file is set")
+	rootCmd.Flags().StringVarP(&LogFile, "log-file", "", "", "append logs to this file instead of stderr")
+	rootCmd.Flags().StringVarP(&OutputFormat, "format", "", "text", "output format for responses: text, csv, json, or jsonl")
+	rootCmd.Flags().StringVarP(&OutputFields, "fields", "", strings.Join(DefaultFields, ","), "comma separated fields to include in csv and json output")
+	rootCmd.Flags().BoolVarP(&JSONIndent, "json-pretty", "", false, "indent json output, the default when stdout is a terminal")
+	rootCmd.Flags().BoolVarP(&JSONCompact, "json-compact", "", false, "write json output on a single line, the default when piped")
+	rootCmd.Flags().BoolVarP(&Resume, "resume", "", false, "continue an interrupted --manifest run, skipping entries recorded in <manifest>.state")
+	rootCmd.Flags().BoolVarP(&DedupeOutput, "dedupe-output", "", false, "with --write, skip appending a response the file already ends with and exit with code 3")
+	rootCmd.Flags().StringVarP(&Manifest, "manifest", "", "", "yaml file listing jobs as {file, instruction, model, output} to process in order")
+	rootCmd.Flags().StringVarP(&PromptFormat, "prompt-format", "", "openai", "how pretext, context, and questions are laid out for completion models: "+strings.Join(PromptFormatNames(), ", "))
+	rootCmd.Flags().BoolVarP(&RedactPrompt, "redact", "", false, "replace secrets (API keys, emails, AWS keys, JWTs) in the prompt with placeholders before sending")
+	rootCmd.Flags().StringVarP(&RedactRules, "redact-rules", "", "", "file of '<name> <regex>' lines to use with --redact instead of the defaults")
+	rootCmd.Flags().BoolVarP(&ParseFileHeaders, "parse-headers", "", false, "apply leading '#!chatgpt key=value' lines in the context as flags, command line flags still win")
+	rootCmd.Flags().StringArrayVarP(&ContextFiles, "context", "", nil, "a file to include in the context before any others, repeatable, useful in a project's .chatgpt.yaml")
+	rootCmd.Flags().StringVarP(&ContextSeparator, "context-separator", "", "--- {file} ---\n", "put before each file when there are several, {file} is replaced with its name")
+	rootCmd.Flags().BoolVarP(&NoContextSeparator, "no-context-separator", "", false, "concatenate several context files with nothing between them")
+	rootCmd.Flags().BoolVarP(&LineNumbers, "line-numbers", "", false, "number the lines of source code context files, so responses can refer to them")
+	rootCmd.Flags().BoolVarP(&ForceUTF8, "force-utf8", "", false, "detect the encoding of context (UTF-16, Windows-1252) and transcode it to UTF-8")
+	rootCmd.Flags().StringArrayVarP(&Images, "image", "", nil, "attach an image file or URL to the first question, for vision models, repeatable")
+	rootCmd.Flags().StringVarP(&Suffix, "suffix", "", "", "text that comes after the completion, so the response is inserted between the context and it")
+	rootCmd.Flags().StringVarP(&SuffixFile, "suffix-file", "", "", "read the --suffix from this file")
+	rootCmd.Flags().StringVarP(&QuestionPosition, "question-position", "", "after", "put the question 'before' or 'after' the file context")
+	rootCmd.Flags().IntVarP(&MaxTurns, "max-turns", "", 0, "end an interactive or scripted session after this many exchanges (0 disables)")
+	rootCmd.Flags().BoolVarP(&NoAutoTitle, "no-auto-title", "", false, "in interactive mode, do not ask the model for a filename when 'save' is given none")
+	rootCmd.Flags().BoolVarP(&PromptEchoStderr, "prompt-echo-stderr", "", false, "in interactive mode, echo the help and prompt to stderr so stdout only has responses")
 
 	// params related
+	rootCmd.Flags().BoolVarP(&NoStream, "no-stream", "", false, "print responses once complete, instead of as they are generated")
 	rootCmd.Flags().IntVarP(&MaxTokens, "tokens", "T", 1024, "set the MaxTokens to generate per response")
-	rootCmd.Flags().IntVarP(&Count, "count", "C", 1, "set the number of response options to create")
+	rootCmd.Flags().IntVarP(&Count, "count", "C", 1, "set the number of response options to create, also --n")
+	rootCmd.Flags().IntVarP(&BestOf, "best-of", "", 0, "generate this many completions server-side and return the --count most likely, completion models only (0 disables)")
+	rootCmd.Flags().StringVarP(&Separator, "separator", "", "", "put this between responses when --count is more than 1, instead of numbering them")
 	rootCmd.Flags().BoolVarP(&Echo, "echo", "E", false, "Echo back the prompt, useful for vim coding")
-	rootCmd.Flags().Float64VarP(&Temp, "temp", "", 0.7, "set the temperature parameter")
-	rootCmd.Flags().Float64VarP(&TopP, "topp", "", 1.0, "set the TopP parameter")
-	rootCmd.Flags().Float64VarP(&PresencePenalty, "pres", "", 0.0, "set the Presence Penalty parameter")
-	rootCmd.Flags().Float64VarP(&FrequencyPenalty, "freq", "", 0.0, "set the Frequency Penalty parameter")
-	rootCmd.Flags().StringVarP(&Model, "model", "m", gpt3.GPT3TextDavinci003, "select the model to use with -q or -e")
+	rootCmd.Flags().IntVarP(&MaxLines, "max-lines", "", 0, "truncate printed responses to this many lines, files still get the full text (0 disables)")
+	rootCmd.Flags().StringArrayVarP(&Stop, "stop", "", nil, "end the response at this sequence, \\n and \\t escapes are allowed, repeat for up to 4")
+	rootCmd.Flags().IntVarP(&Logprobs, "logprobs", "", 0, "print the log probability of each token and its N most likely alternatives (0 disables)")
+	rootCmd.Flags().IntVarP(&Seed, "seed", "", 0, "ask for repeatable sampling with this seed, the system fingerprint is printed to compare runs")
+	rootCmd.Flags().StringArrayVarP(&LogitBiasFlags, "logit-bias", "", nil, "raise or lower the odds of a token, as '<token id>:<weight>' with weight in [-100,100], only ids are taken, not words, repeatable")
+	rootCmd.Flags().Float64VarP(&Temp, "temp", "", 0.7, "set the temperature parameter [0.0,2.0], also --temperature or $CHATGPT_TEMPERATURE")
+	rootCmd.Flags().Float64VarP(&TopP, "topp", "", 1.0, "set the TopP parameter [0.0,1.0], also --top-p or $CHATGPT_TOP_P")
+	rootCmd.Flags().Float64VarP(&PresencePenalty, "pres", "", 0.0, "set the Presence Penalty parameter [-2.0,2.0], also --presence-penalty or $CHATGPT_PRESENCE_PENALTY")
+	rootCmd.Flags().Float64VarP(&FrequencyPenalty, "freq", "", 0.0, "set the Frequency Penalty parameter [-2.0,2.0], also --frequency-penalty or $CHATGPT_FREQUENCY_PENALTY")
+	rootCmd.Flags().StringVarP(&Model, "model", "m", gpt3.GPT3Dot5Turbo, "select the model to use, defaults to $CHATGPT_MODEL when set")
+	rootCmd.Flags().StringVarP(&User, "user", "", "", "stable end-user id sent with requests for abuse monitoring, defaults to $CHATGPT_USER")
+	rootCmd.Flags().BoolVarP(&StrictParams, "strict-params", "", false, "fail instead of dropping parameters the model does not support")
+	rootCmd.Flags().StringVarP(&ReplayDir, "replay", "", "", "directory of responses recorded by prompt hash, replayed when found and recorded when not")
+	rootCmd.Flags().BoolVarP(&ReplayOnly, "replay-only", "", false, "with --replay, fail instead of calling the API when no recording exists")
+
+	rootCmd.Flags().StringVarP(&Moderation, "moderate", "", "", "check each question with the moderation endpoint first, and 'refuse' to send or 'warn' when flagged")
+	rootCmd.Flags().Lookup("moderate").NoOptDefVal = "refuse"
+
+	// tool related
+	rootCmd.Flags().BoolVarP(&ToolsBuiltin, "tools", "", false, "let chat models call the shell and http_get tools, confirmed each time, and read_file, confirmed outside the working directory")
+	rootCmd.Flags().StringVarP(&ToolsFile, "tools-file", "", "", "yaml file of more tools as {name, description, parameters, command, confirm}, commands get the arguments as JSON on stdin")
+
+	// assistant related
+	rootCmd.Flags().StringVarP(&AssistantID, "assistant", "", "", "talk to this assistant in a server-side thread, which is remembered for the next run")
+	rootCmd.Flags().StringVarP(&ThreadID, "thread", "", "", "with --assistant, continue this thread instead of the remembered one")
+	rootCmd.Flags().BoolVarP(&NewThread, "new-thread", "", false, "with --assistant, start a new thread and remember it")
+	rootCmd.Flags().StringArrayVarP(&Attachments, "attach", "", nil, "with --assistant, upload this file for the code interpreter, repeatable")
+	rootCmd.Flags().BoolVarP(&CodeInterpreter, "code-interpreter", "", false, "with --assistant, let the assistant run code")
+
+	// connection related, shared with subcommands
+	rootCmd.PersistentFlags().StringVarP(&ConfigFile, "config", "", "", "yaml file of default settings, as long flag names and values (default "+DefaultConfigFile()+")")
+	rootCmd.PersistentFlags().StringVarP(&Profile, "profile", "", "", "use the settings of this profile in the config file, over its other settings")
+	rootCmd.PersistentFlags().StringVarP(&APIKeyFile, "api-key-file", "", "", "read the API key from this file, instead of CHATGPT_API_KEY, OPENAI_API_KEY, or "+DefaultKeyFile()+", files and the variables can have several keys, one per line or comma separated")
+	rootCmd.PersistentFlags().StringVarP(&KeyRotation, "key-rotation", "", "failover", "with several keys, failover uses the next key when one is rate limited, round-robin also takes turns on every request")
+	rootCmd.PersistentFlags().StringVarP(&AuthHeader, "auth-header", "", "Authorization", "header to send the API key in")
+	rootCmd.PersistentFlags().StringVarP(&AuthScheme, "auth-scheme", "", "Bearer", "scheme to put before the API key in the auth header, may be empty")
+	rootCmd.PersistentFlags().DurationVarP(&KeepAlive, "keepalive", "", 90*time.Second, "how long idle connections to the API are kept open for reuse")
+	rootCmd.PersistentFlags().BoolVarP(&Warm, "warmup", "", false, "open the API connection when an interactive session starts, so the first question is faster")
+	rootCmd.PersistentFlags().StringVarP(&AuthQuery, "auth-query", "", "", "send the API key as this query parameter instead of a header")
+	rootCmd.PersistentFlags().StringVarP(&APIBase, "api-base", "", "", "URL of an OpenAI-compatible API to use instead, like http://localhost:11434/v1 for Ollama (default $CHATGPT_API_BASE)")
+	rootCmd.PersistentFlags().StringVarP(&ProviderName, "provider", "", "openai", "the API to use: openai, azure, anthropic, or gemini")
+	rootCmd.PersistentFlags().StringArrayVarP(&Fallbacks, "fallback", "", nil, "provider:model to retry chat requests with when the --provider fails or is rate limited, repeatable, tried in order")
+	rootCmd.PersistentFlags().StringVarP(&AzureEndpoint, "azure-endpoint", "", "", "with --provider azure, the resource endpoint, like https://NAME.openai.azure.com (default $AZURE_OPENAI_ENDPOINT)")
+	rootCmd.PersistentFlags().StringVarP(&AzureDeployment, "azure-deployment", "", "", "with --provider azure, the deployment to send requests to (default: a deployment named after --model)")
+	rootCmd.PersistentFlags().StringVarP(&AzureAPIVersion, "azure-api-version", "", defaultAzureAPIVersion, "with --provider azure, the api-version of each request")
+	rootCmd.PersistentFlags().IntVarP(&RequestRetries, "request-retries", "", 3, "maximum number of retries of requests failing with rate limits, server errors, or dropped connections")
+	rootCmd.PersistentFlags().DurationVarP(&Timeout, "timeout", "", 0, "give up on a request after this long, like 30s or 2m, responses are read within it too (default no limit)")
+	rootCmd.PersistentFlags().StringArrayVarP(&Headers, "header", "", nil, "add a 'Name: value' header to every API request, for gateways that need them, repeatable")
+	rootCmd.PersistentFlags().StringVarP(&CACert, "ca-cert", "", "", "also trust the certificates in this PEM file, for TLS-intercepting proxies")
+	rootCmd.PersistentFlags().StringVarP(&ClientCert, "client-cert", "", "", "present this PEM certificate to the server, for mTLS gateways")
+	rootCmd.PersistentFlags().StringVarP(&ClientKey, "client-key", "", "", "the PEM key of the --client-cert (default: the key in the --client-cert file)")
+	rootCmd.PersistentFlags().BoolVarP(&Insecure, "insecure", "", false, "do not verify TLS certificates, as a last resort, the key can then be intercepted")
+	rootCmd.PersistentFlags().StringVarP(&Proxy, "proxy", "", "", "send requests through this proxy, like http://host:3128 or socks5://host:1080 (default $HTTPS_PROXY or $ALL_PROXY)")
+	rootCmd.PersistentFlags().StringVarP(&OrgID, "org", "", "", "bill requests to this OpenAI organization, for keys of several (default $OPENAI_ORG_ID)")
+	rootCmd.PersistentFlags().StringVarP(&ProjectID, "project", "", "", "bill requests to this OpenAI project (default $OPENAI_PROJECT_ID)")
+	rootCmd.PersistentFlags().Float64VarP(&BudgetDaily, "budget-daily", "", 0, "refuse requests once the estimated cost of today reaches this many USD (0 disables)")
+	rootCmd.PersistentFlags().Float64VarP(&BudgetMonthly, "budget-monthly", "", 0, "refuse requests once the estimated cost of this month reaches this many USD (0 disables)")
+	rootCmd.PersistentFlags().BoolVarP(&Force, "force", "", false, "send requests even when a budget is spent")
+	rootCmd.PersistentFlags().StringSliceVarP(&ModerateCategories, "moderate-categories", "", nil, "only these comma separated categories count for --moderate and the moderate command, like hate,violence")
+
+	// runs before every command, the client is set up for subcommands too
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		err := LoadDotEnv()
+		if err == nil {
+			// flag defaults would overwrite values read before parsing
+			err = SetDefaults(cmd)
+		}
+		if err == nil {
+			err = ConfigureTransport()
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		err = LoadAPIKey()
+		if err == nil && NeedsSetup() {
+			err = RunSetup(cmd, client)
+		}
+		if err == nil {
+			err = ConfigureClient(client)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	rootCmd.AddCommand(NewBenchCmd(client))
+	rootCmd.AddCommand(NewSessionsCmd())
+	rootCmd.AddCommand(NewModelsCmd(client))
+	rootCmd.AddCommand(NewImageCmd(client))
+	rootCmd.AddCommand(NewTranscribeCmd(client))
+	rootCmd.AddCommand(NewSpeakCmd(client))
+	rootCmd.AddCommand(NewEmbedCmd(client))
+	rootCmd.AddCommand(NewModerateCmd(client))
+	rootCmd.AddCommand(NewFinetuneCmd(client))
+	rootCmd.AddCommand(NewConfigCmd(rootCmd))
+	rootCmd.AddCommand(NewAuthCmd(client))
 
 	// run the command
 	rootCmd.Execute()
 }
 
 func RunPrompt(client *gpt3.Client) error {
+	lines, err := NewLineReader()
+	if err != nil {
+		return err
+	}
+	// the terminal is put back as it was
+	if c, ok := lines.(io.Closer); ok {
+		defer c.Close()
+	}
+	_, err = RunSession(client, lines)
+	return err
+}
+
+// RunSession runs the interactive loop over the lines read from lines.
+// It reports whether the session was ended with 'quit'
+func RunSession(client *gpt3.Client, lines LineReader) (bool, error) {
 	ctx := context.Background()
-	scanner := bufio.NewScanner(os.Stdin)
 	quit := false
 
 	for !quit {
-		fmt.Print("> ")
-
-		if !scanner.Scan() {
+		question, multiline, err := ReadQuestion(lines, "> ")
+		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			return quit, err
+		}
 
-		question := scanner.Text()
 		parts := strings.Fields(question)
+		if len(parts) == 0 {
+			continue
+		}
 
-		// look for commands
-		switch parts[0] {
+		// look for commands, with or without a leading slash,
+		// a question of several lines is always sent
+		command := strings.TrimPrefix(parts[0], "/")
+		if multiline {
+			command = ""
+		}
+		switch command {
 		case "quit", "q", "exit":
 			quit = true
 			continue
 
+		case "models":
+			err := ModelsCommand(client, ctx, parts[1:])
+			if err != nil {
+				fmt.Println(err)
+			}
+			continue
+
+		case "edit-last":
+			err := EditLastCommand()
+			if err != nil {
+				fmt.Println(err)
+			}
+			continue
+
+		case "speak":
+			SpeakPlay = true
+			text, err := LastResponse(&Session)
+			if err == nil {
+				err = Speak(client, ctx, text)
+			}
+			if err != nil {
+				fmt.Println(err)
+			}
+			continue
+
+		case "help":
+			fmt.Println(interactiveHelp)
+			continue
+
+		case "reset":
+			Session.Reset()
+			fmt.Println("the conversation is reset")
+			continue
+
+		case "undo":
+			q, ok := Session.Undo()
+			if !ok {
+				fmt.Println("there is no exchange to undo")
+				continue
+			}
+			q, _, _ = strings.Cut(q, "\n")
+			fmt.Println("took back:", q)
+			continue
+
+		case "regen", "retry":
+			prev := Session.Copy()
+			if !Session.DropAnswer() {
+				fmt.Println("there is no question to ask again yet")
+				continue
+			}
+			// a temperature given is only for this response
+			temp := Temp
+			if len(parts) > 1 {
+				Temp, err = strconv.ParseFloat(parts[1], 64)
+				if err == nil {
+					err = CheckRanges()
+				}
+				if err != nil {
+					Temp = temp
+					fmt.Println(err)
+					continue
+				}
+			}
+			quit, err = AskSession(client, ctx, lines)
+			Temp = temp
+			if err != nil {
+				return false, err
+			}
+			// the old response stays when the new one was cancelled or refused
+			if len(Session.Messages) < len(prev.Messages) {
+				Session = prev
+			}
+			continue
+
+		case "prompts", "pretexts", "pretext":
+			err := PromptsCommand(parts[1:])
+			if err != nil {
+				fmt.Println(err)
+			}
+			continue
+
 		case "save":
-			name := parts[1]
+			var name string
+			if len(parts) > 1 {
+				name = parts[1]
+			} else if NoAutoTitle {
+				fmt.Println("save needs a filename, or drop --no-auto-title to have one generated")
+				continue
+			} else {
+				title, err := SessionTitle(client, ctx)
+				if err != nil {
+					fmt.Println(err)
+					continue
+				}
+				name = title + ".json"
+			}
 			fmt.Printf("saving session to %s\n", name)
 
-			err := os.WriteFile(name, []byte(PromptText), 0644)
+			err := SaveSession(&Session, name)
 			if err != nil {
 				fmt.Println(err)
 			}
@@ -477,7 +1372,13 @@ func RunPrompt(client *gpt3.Client) error {
 				continue
 			}
 
-			Model = parts[1]
+			model := ResolveModel(parts[1])
+			err := ValidateModel(model)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			Model = model
 			fmt.Println("model is now", Model)
 			continue
 
@@ -564,96 +1465,210 @@ func RunPrompt(client *gpt3.Client) error {
 			fmt.Println("freq is now", FrequencyPenalty)
 
 		default:
-			// add the question to the existing prompt text, to keep context
-			PromptText += "\n> " + question
-			var R []string
-			var err error
-
-			if CodeMode {
-				R, err = GetCodeResponse(client, ctx, PromptText)
-			} else if EditMode {
-				R, err = GetEditsResponse(client, ctx, PromptText, Question)
-			} else {
-				R, err = GetCompletionResponse(client, ctx, PromptText)
+			// inline any @file mentions
+			question, err = ExpandMentions(question)
+			if err != nil {
+				fmt.Println(err)
+				continue
 			}
+
+			// add the question to the existing conversation, to keep context
+			Session.Add(UserMessage(question))
+
+			quit, err = AskSession(client, ctx, lines)
 			if err != nil {
-				return err
+				return false, err
 			}
+		}
+	}
 
-			final := ""
+	return quit, nil
+}
 
-			if len(R) == 1 {
-				final = R[0]
-			} else {
-				for i, r := range R {
-					final += fmt.Sprintf("[%d]: %s\n\n", i, r)
-				}
-				fmt.Println(final)
-				ok := false
-				pos := 0
+// AskSession adds the answer to the last question of the Session, lines is read
+// to pick one of several responses. It reports whether --max-turns has been reached
+func AskSession(client *gpt3.Client, ctx context.Context, lines LineReader) (bool, error) {
+	// Ctrl+C while waiting takes back the question, instead of ending the session
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	err := CheckModeration(client, ctx, &Session)
+	if errors.Is(err, ErrFlagged) {
+		dropQuestion(err)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
 
-				for !ok {
-					fmt.Print("> ")
+	if Streaming() {
+		final, err := GetStreamResponse(client, ctx, &Session, os.Stdout)
+		fmt.Print("\n\n")
+		if ctx.Err() != nil {
+			cancelQuestion()
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		Session.Add(AssistantMessage(strings.TrimSpace(final)))
+		return countTurn(), nil
+	}
 
-					if !scanner.Scan() {
-						break
-					}
+	R, err := GetResponse(client, ctx, &Session, Question)
+	if ctx.Err() != nil {
+		fmt.Println()
+		cancelQuestion()
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
 
-					ans := scanner.Text()
-					pos, err = strconv.Atoi(ans)
-					if err != nil {
-						fmt.Println(err)
-						continue
-					}
-					if pos < 0 || pos >= Count {
-						fmt.Println("choice must be between 0 and", Count-1)
-						continue
-					}
-					ok = true
-				}
+	final := ""
 
-				final = R[pos]
+	if len(R) == 1 {
+		final = R[0]
+	} else {
+		for i, r := range R {
+			final += fmt.Sprintf("[%d]: %s\n\n", i, r)
+		}
+		fmt.Println(final)
+		ok := false
+		pos := 0
+
+		for !ok {
+			ans, err := lines.ReadLine("> ")
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return false, err
 			}
 
-			// we add response to the prompt, this is how ChatGPT sessions keep context
-			PromptText += "\n" + strings.TrimSpace(final)
-			// print the latest portion of the conversation
-			fmt.Println(final + "\n")
+			pos, err = strconv.Atoi(ans)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if pos < 0 || pos >= Count {
+				fmt.Println("choice must be between 0 and", Count-1)
+				continue
+			}
+			ok = true
 		}
+
+		final = R[pos]
 	}
 
-	return nil
+	// we add response to the conversation, this is how ChatGPT sessions keep context
+	Session.Add(AssistantMessage(strings.TrimSpace(final)))
+	// print the latest portion of the conversation
+	fmt.Println(TruncateLines(final) + "\n")
+
+	return countTurn(), nil
+}
+
+// dropQuestion takes back a question refused by --moderate, so the session can go on
+func dropQuestion(err error) {
+	Session.Messages = Session.Messages[:len(Session.Messages)-1]
+	fmt.Println(err)
+}
+
+// cancelQuestion takes back a question after Ctrl+C, the response is not kept
+// even when part of it was streamed
+func cancelQuestion() {
+	interrupted = true
+	Session.Messages = Session.Messages[:len(Session.Messages)-1]
+	fmt.Println("request cancelled, press Ctrl+C again or Ctrl+D to exit")
+}
+
+// countTurn adds the last exchange to the session totals
+// and reports whether --max-turns has been reached
+func countTurn() bool {
+	turnsTaken++
+	turnUsage.PromptTokens += LastUsage.PromptTokens
+	turnUsage.CompletionTokens += LastUsage.CompletionTokens
+	turnUsage.TotalTokens += LastUsage.TotalTokens
+	if MaxTurns == 0 || turnsTaken < MaxTurns {
+		return false
+	}
+	fmt.Printf("reached --max-turns %d, ending the session\n", MaxTurns)
+	fmt.Printf("%d turns, %d prompt + %d completion = %d tokens\n",
+		turnsTaken, turnUsage.PromptTokens, turnUsage.CompletionTokens, turnUsage.TotalTokens)
+	return true
 }
 
 func RunOnce(client *gpt3.Client, filename string) error {
 	ctx := context.Background()
 
 	var R []string
-	var err error
+	// once, retries for --until send the same question
+	err := CheckModeration(client, ctx, &Session)
+	if err != nil {
+		return err
+	}
 
-	if CodeMode {
-		R, err = GetCodeResponse(client, ctx, PromptText)
-	} else if EditMode {
-		R, err = GetEditsResponse(client, ctx, PromptText, Question)
+	printing := OutputFormat == "text" && (filename == "" || !WriteBack)
+	if printing && Streaming() {
+		_, err = GetStreamResponse(client, ctx, &Session, os.Stdout)
+		fmt.Println()
+		noteFingerprint()
+		return err
+	}
+
+	if Validating() {
+		R, err = GetValidResponse(client, ctx, Session, Question)
 	} else {
-		R, err = GetCompletionResponse(client, ctx, PromptText)
+		R, err = GetResponse(client, ctx, &Session, Question)
 	}
 	if err != nil {
 		return err
 	}
+	noteFingerprint()
 
-	final := ""
-	if len(R) == 1 {
-		final = R[0]
-	} else {
-		for i, r := range R {
-			final += fmt.Sprintf("[%d]: %s\n\n", i, r)
+	final := JoinResponses(R)
+
+	if OutputFormat != "text" {
+		rows, err := NewResultWriter(os.Stdout)
+		if err != nil {
+			return err
+		}
+		err = rows.Write(Result{
+			File:        filename,
+			Prompt:      Session.Render(true),
+			Response:    final,
+			Model:       Model,
+			User:        User,
+			Usage:       LastUsage,
+			Logprobs:    LastLogprobs,
+			Fingerprint: LastFingerprint,
+		})
+		if err != nil {
+			return err
 		}
+		return rows.Close()
 	}
 
-	if filename == "" || !WriteBack {
-		fmt.Println(final)
+	if printing && EditMode {
+		// only the document, with its own trailing newline, for filters like vim's !
+		fmt.Print(TruncateLines(final))
+	} else if printing {
+		fmt.Println(TruncateLines(final))
+		if Logprobs > 0 {
+			fmt.Println()
+			PrintLogprobs(os.Stdout, LastLogprobs)
+		}
 	} else {
+		if DedupeOutput {
+			same, err := EndsWith(filename, final)
+			if err != nil {
+				return err
+			}
+			if same {
+				return ErrNoChange
+			}
+		}
 		err = AppendToFile(filename, final)
 		if err != nil {
 			return err
@@ -663,6 +1678,62 @@ func RunOnce(client *gpt3.Client, filename string) error {
 	return nil
 }
 
+// noteFingerprint shows which backend configuration served a seeded request,
+// outputs only repeat while it stays the same
+func noteFingerprint() {
+	if Seeded && LastFingerprint != "" {
+		Notef("system fingerprint: %s\n", LastFingerprint)
+	}
+}
+
+// ErrNoChange is returned when --dedupe-output skips appending a repeated response
+var ErrNoChange = errors.New("response is the same as the end of the file, not appending")
+
+// EndsWith reports whether the file already ends with data
+func EndsWith(filename string, data string) (bool, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+	return strings.HasSuffix(strings.TrimRight(string(content), "\n"), strings.TrimRight(data, "\n")), nil
+}
+
+// Notef prints a progress note to stderr, unless --quiet
+func Notef(format string, a ...interface{}) {
+	if !Quiet {
+		fmt.Fprintf(os.Stderr, format, a...)
+	}
+}
+
+// JoinResponses numbers the responses when there is more than one,
+// or puts --separator between them when it is set
+func JoinResponses(R []string) string {
+	if len(R) == 1 {
+		return R[0]
+	}
+	if Separator != "" {
+		return strings.Join(R, Separator)
+	}
+	final := ""
+	for i, r := range R {
+		final += fmt.Sprintf("[%d]: %s\n\n", i, r)
+	}
+	return final
+}
+
+// TruncateLines limits text to MaxLines for display, noting how much was cut
+func TruncateLines(text string) string {
+	if MaxLines <= 0 {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) <= MaxLines {
+		return text
+	}
+	more := len(lines) - MaxLines
+	return strings.Join(lines[:MaxLines], "\n") + fmt.Sprintf("\n… (truncated, %d more lines)", more)
+}
+
 // AppendToFile provides a function to append data to an existing file,
 // creating it if it doesn't exist
 func AppendToFile(filename string, data string) error {
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestEntry pairs a context file with the instruction to run on it
+type ManifestEntry struct {
+	File        string `yaml:"file"`
+	Instruction string `yaml:"instruction"`
+	Model       string `yaml:"model,omitempty"`
+	// where to write the response, defaults to stdout,
+	// or the end of File when --write is set
+	Output string `yaml:"output,omitempty"`
+}
+
+func ReadManifest(filename string) ([]ManifestEntry, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ManifestEntry
+	err = yaml.Unmarshal(content, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest %s: %w", filename, err)
+	}
+	return entries, nil
+}
+
+// RunManifest processes every entry in the manifest, prefixed by the
+// current PromptText, and prints a summary of the results at the end
+func RunManifest(client *gpt3.Client, filename string) error {
+	entries, err := ReadManifest(filename)
+	if err != nil {
+		return err
+	}
+
+	state, err := LoadBatchState(filename, Resume)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pretext := PromptText
+	model := Model
+	failed := 0
+	summary := make([]string, len(entries))
+
+	var rows ResultWriter
+	if OutputFormat != "text" {
+		rows, err = NewResultWriter(os.Stdout)
+		if err != nil {
+			return err
+		}
+	}
+
+	skipped := 0
+	for i, e := range entries {
+		if state.Finished(i, e.File) {
+			skipped++
+			summary[i] = fmt.Sprintf("  [%d] %s: done in an earlier run", i, e.File)
+			continue
+		}
+
+		r, err := runManifestEntry(client, ctx, pretext, e)
+		if err == nil {
+			if rows != nil {
+				err = rows.Write(r)
+			} else if e.Output == "" && !WriteBack {
+				fmt.Printf("--- %s ---\n%s\n", e.File, TruncateLines(r.Response))
+			}
+		}
+		if err != nil {
+			failed++
+			summary[i] = fmt.Sprintf("  [%d] %s: FAIL %v", i, e.File, err)
+			if hint := ExplainError(err); hint != "" {
+				summary[i] += "\n      " + strings.ReplaceAll(hint, "\n", "\n      ")
+			}
+		} else {
+			summary[i] = fmt.Sprintf("  [%d] %s: ok", i, e.File)
+			// hashed after any --write, so a resume sees the file unchanged
+			if serr := state.MarkDone(i, e.File); serr != nil {
+				fmt.Fprintln(os.Stderr, serr)
+			}
+		}
+		Model = model
+	}
+
+	if rows != nil {
+		err = rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "manifest: %d succeeded, %d failed, %d skipped\n", len(entries)-failed-skipped, failed, skipped)
+	fmt.Fprintln(os.Stderr, strings.Join(summary, "\n"))
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d manifest entries failed", failed, len(entries))
+	}
+	return nil
+}
+
+func runManifestEntry(client *gpt3.Client, ctx context.Context, pretext string, e ManifestEntry) (Result, error) {
+	if e.File == "" {
+		return Result{}, fmt.Errorf("missing file")
+	}
+	if e.Model != "" {
+		Model = e.Model
+	}
+	err := ValidateModel(Model)
+	if err != nil {
+		return Result{}, err
+	}
+
+	content, err := ReadContextFile(e.File)
+	if err != nil {
+		return Result{}, err
+	}
+
+	question := ""
+	if !EditMode {
+		question = e.Instruction
+	}
+	conv := NewConversation(pretext, content, question)
+	prompt := conv.Render(true)
+
+	err = CheckModeration(client, ctx, &conv)
+	if err != nil {
+		return Result{}, err
+	}
+	R, err := GetResponse(client, ctx, &conv, e.Instruction)
+	if err != nil {
+		return Result{}, err
+	}
+
+	r := Result{
+		File:        e.File,
+		Prompt:      prompt,
+		Response:    JoinResponses(R),
+		Model:       Model,
+		User:        User,
+		Usage:       LastUsage,
+		Logprobs:    LastLogprobs,
+		Fingerprint: LastFingerprint,
+	}
+
+	switch {
+	case e.Output != "":
+		err = os.WriteFile(e.Output, []byte(r.Response), 0644)
+	case WriteBack:
+		err = AppendToFile(e.File, r.Response)
+	}
+	return r, err
+}
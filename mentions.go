@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandMentions inlines the files referenced as @path, or @glob, in an interactive turn.
+// Mentions which match no files are left as they are
+func ExpandMentions(question string) (string, error) {
+	words := strings.Fields(question)
+	var files []string
+	for _, w := range words {
+		if !strings.HasPrefix(w, "@") || len(w) == 1 {
+			continue
+		}
+		matches, err := filepath.Glob(strings.TrimPrefix(w, "@"))
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", w, err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return question, nil
+	}
+
+	text := question
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return "", err
+		}
+		if info.IsDir() {
+			continue
+		}
+		content, err := ReadContextFile(f)
+		if err != nil {
+			return "", err
+		}
+		text += fmt.Sprintf("\n\n--- %s ---\n%s", f, content)
+		fmt.Printf("included %s (~%d tokens)\n", f, EstimateTokens(content))
+	}
+	return text, nil
+}
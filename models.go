@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+func NewModelsCmd(client *gpt3.Client) *cobra.Command {
+	return &cobra.Command{
+		Use:   "models",
+		Short: "list the models available to the API key and what each can be used for",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := PrintModels(client, context.Background())
+			if err != nil {
+				PrintError(err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+// PrintModels lists the models with their family, chat and completion
+// models can be given to --model, edit models to -e --model
+func PrintModels(client *gpt3.Client, ctx context.Context) error {
+	models, err := client.ListModels(ctx)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	width := 0
+	for _, m := range models.Models {
+		ids = append(ids, m.ID)
+		if len(m.ID) > width {
+			width = len(m.ID)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		fmt.Printf("%-*s  %s\n", width, id, ModelFamily(id))
+	}
+	return nil
+}
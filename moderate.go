@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+// ErrFlagged is returned when --moderate refuses a prompt
+var ErrFlagged = fmt.Errorf("the prompt was flagged by moderation, not sending it")
+
+func NewModerateCmd(client *gpt3.Client) *cobra.Command {
+	return &cobra.Command{
+		Use:   "moderate [text...]",
+		Short: "check text, or stdin, with the moderation endpoint, exiting with code 2 when flagged",
+		Run: func(cmd *cobra.Command, args []string) {
+			text := strings.Join(args, " ")
+			var err error
+			if len(args) == 0 {
+				text, err = ReadStdin()
+			}
+			var flagged []string
+			if err == nil {
+				flagged, err = Moderate(client, context.Background(), text)
+			}
+			if err != nil {
+				PrintError(err)
+				os.Exit(1)
+			}
+			if len(flagged) > 0 {
+				fmt.Println("flagged:", strings.Join(flagged, ", "))
+				os.Exit(2)
+			}
+			fmt.Println("not flagged")
+		},
+	}
+}
+
+// Moderate returns the categories the text is flagged for,
+// only those in --moderate-categories when it is set
+func Moderate(client *gpt3.Client, ctx context.Context, text string) ([]string, error) {
+	resp, err := client.Moderations(ctx, gpt3.ModerationRequest{Input: text})
+	if err != nil {
+		return nil, err
+	}
+
+	var flagged []string
+	for _, r := range resp.Results {
+		b, err := json.Marshal(r.Categories)
+		if err != nil {
+			return nil, err
+		}
+		categories := map[string]bool{}
+		err = json.Unmarshal(b, &categories)
+		if err != nil {
+			return nil, err
+		}
+		for name, on := range categories {
+			if on && moderatedCategory(name) {
+				flagged = append(flagged, name)
+			}
+		}
+	}
+	sort.Strings(flagged)
+	return flagged, nil
+}
+
+// moderatedCategory reports whether a category counts, a parent
+// like 'hate' in --moderate-categories includes 'hate/threatening'
+func moderatedCategory(name string) bool {
+	if len(ModerateCategories) == 0 {
+		return true
+	}
+	for _, c := range ModerateCategories {
+		if name == c || strings.HasPrefix(name, c+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckModeration runs the latest user message through moderation before it is sent,
+// redacted as it would be sent, warning or refusing with ErrFlagged as --moderate says.
+// It is checked once per question, not again for each retry
+func CheckModeration(client *gpt3.Client, ctx context.Context, conv *Conversation) error {
+	if Moderation == "" {
+		return nil
+	}
+	text := ""
+	for i := len(conv.Messages) - 1; i >= 0; i-- {
+		if conv.Messages[i].Role == gpt3.ChatMessageRoleUser {
+			text = conv.Messages[i].Content
+			break
+		}
+	}
+	if text == "" {
+		return nil
+	}
+	if RedactPrompt {
+		text = Redact(text)
+	}
+
+	flagged, err := Moderate(client, ctx, text)
+	if err != nil {
+		return err
+	}
+	if len(flagged) == 0 {
+		return nil
+	}
+	if Moderation == "warn" {
+		fmt.Fprintf(os.Stderr, "warning: the prompt was flagged by moderation for %s\n", strings.Join(flagged, ", "))
+		return nil
+	}
+	return fmt.Errorf("%w (%s)", ErrFlagged, strings.Join(flagged, ", "))
+}
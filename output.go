@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// Result is one response, with what is needed to report on it
+type Result struct {
+	File        string
+	Prompt      string
+	Response    string
+	Model       string
+	User        string
+	Usage       gpt3.Usage
+	Logprobs    []TokenLogprob // of the first response, with --logprobs
+	Fingerprint string
+}
+
+var ResultFields = []string{"file", "prompt", "response", "model", "user", "prompt_tokens", "completion_tokens", "cost", "logprobs", "fingerprint"}
+
+var DefaultFields = []string{"file", "prompt", "response", "model", "prompt_tokens", "completion_tokens", "cost"}
+
+func (r Result) Field(name string) string {
+	switch name {
+	case "file":
+		return r.File
+	case "prompt":
+		return r.Prompt
+	case "response":
+		return r.Response
+	case "model":
+		return r.Model
+	case "user":
+		return r.User
+	case "fingerprint":
+		return r.Fingerprint
+	case "prompt_tokens":
+		return strconv.Itoa(r.Usage.PromptTokens)
+	case "completion_tokens":
+		return strconv.Itoa(r.Usage.CompletionTokens)
+	case "cost":
+		cost, ok := EstimateCost(r.Model, r.Usage)
+		if !ok {
+			return ""
+		}
+		return strconv.FormatFloat(cost, 'f', 6, 64)
+	case "logprobs":
+		if r.Logprobs == nil {
+			return ""
+		}
+		b, _ := json.Marshal(r.Logprobs)
+		return string(b)
+	}
+	return ""
+}
+
+// Value returns the field with its JSON type
+func (r Result) Value(name string) interface{} {
+	switch name {
+	case "prompt_tokens":
+		return r.Usage.PromptTokens
+	case "completion_tokens":
+		return r.Usage.CompletionTokens
+	case "cost":
+		cost, ok := EstimateCost(r.Model, r.Usage)
+		if !ok {
+			return nil
+		}
+		return cost
+	case "logprobs":
+		return r.Logprobs
+	}
+	return r.Field(name)
+}
+
+// ParseFields validates a comma separated list of result fields
+func ParseFields(list string) ([]string, error) {
+	fields := strings.Split(list, ",")
+	for i, f := range fields {
+		fields[i] = strings.TrimSpace(f)
+		known := false
+		for _, k := range ResultFields {
+			known = known || k == fields[i]
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown field %q, use any of %s", fields[i], strings.Join(ResultFields, ","))
+		}
+	}
+	return fields, nil
+}
+
+// ResultWriter writes results in one of the structured --format options
+type ResultWriter interface {
+	Write(r Result) error
+	Close() error
+}
+
+// NewResultWriter returns a writer for OutputFormat, which must not be text
+func NewResultWriter(out io.Writer) (ResultWriter, error) {
+	fields, err := ParseFields(OutputFields)
+	if err != nil {
+		return nil, err
+	}
+
+	switch OutputFormat {
+	case "csv":
+		return NewCSVWriter(out, fields)
+	case "json":
+		return &JSONWriter{out: out, fields: fields, pretty: JSONPretty()}, nil
+	case "jsonl":
+		return &JSONWriter{out: out, fields: fields, lines: true}, nil
+	}
+	return nil, fmt.Errorf("unknown --format %q, use text, csv, json, or jsonl", OutputFormat)
+}
+
+// CSVWriter writes results as CSV rows, starting with a header of the fields
+type CSVWriter struct {
+	w      *csv.Writer
+	fields []string
+}
+
+func NewCSVWriter(out io.Writer, fields []string) (*CSVWriter, error) {
+	w := csv.NewWriter(out)
+	err := w.Write(fields)
+	return &CSVWriter{w: w, fields: fields}, err
+}
+
+func (c *CSVWriter) Write(r Result) error {
+	row := make([]string, len(c.fields))
+	for i, f := range c.fields {
+		row[i] = r.Field(f)
+	}
+	err := c.w.Write(row)
+	if err != nil {
+		return err
+	}
+	// flush as we go, so long batches show progress
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *CSVWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// JSONPretty reports whether JSON output is indented, by default
+// only when stdout is a terminal, --json-pretty and --json-compact override
+func JSONPretty() bool {
+	if JSONCompact {
+		return false
+	}
+	if JSONIndent {
+		return true
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// JSONWriter writes results as an array of objects, or one object per line
+type JSONWriter struct {
+	out     io.Writer
+	fields  []string
+	pretty  bool
+	lines   bool
+	results []map[string]interface{}
+}
+
+func (j *JSONWriter) Write(r Result) error {
+	obj := map[string]interface{}{}
+	for _, f := range j.fields {
+		obj[f] = r.Value(f)
+	}
+	if !j.lines {
+		// arrays are written whole on Close
+		j.results = append(j.results, obj)
+		return nil
+	}
+	return j.encode(obj)
+}
+
+func (j *JSONWriter) Close() error {
+	if j.lines {
+		return nil
+	}
+	// always an array, so one question and a manifest are read the same way
+	if j.results == nil {
+		j.results = []map[string]interface{}{}
+	}
+	return j.encode(j.results)
+}
+
+func (j *JSONWriter) encode(v interface{}) error {
+	enc := json.NewEncoder(j.out)
+	if j.pretty {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// settings a prompt can give defaults for in its front-matter
+var pretextSettings = []string{"model", "temp", "topp", "pres", "freq", "tokens", "stop", "count", "seed", "json-output"}
+
+// ListPrompts returns the names of the prompts in PromptDir,
+// or the embedded defaults when it is not set
+func ListPrompts() ([]string, error) {
+	var files []fs.DirEntry
+	var err error
+
+	if PromptDir == "" {
+		files, err = predefined.ReadDir("prompts")
+	} else {
+		files, err = os.ReadDir(PromptDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, f := range files {
+		names = append(names, strings.TrimSuffix(f.Name(), ".txt"))
+	}
+	return names, nil
+}
+
+// ReadPrompt returns the contents of the named prompt
+func ReadPrompt(name string) (string, error) {
+	var contents []byte
+	var err error
+
+	if PromptDir == "" {
+		contents, err = predefined.ReadFile("prompts/" + name + ".txt")
+	} else {
+		contents, err = os.ReadFile(filepath.Join(PromptDir, name+".txt"))
+	}
+	return string(contents), err
+}
+
+// SplitFrontMatter separates the yaml settings between '---' lines
+// at the top of a prompt from the text of the prompt
+func SplitFrontMatter(contents string) (map[string]interface{}, string, error) {
+	rest, ok := strings.CutPrefix(strings.ReplaceAll(contents, "\r\n", "\n"), "---\n")
+	if !ok {
+		return nil, contents, nil
+	}
+	front, text, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		return nil, "", fmt.Errorf("the front-matter is not ended with a '---' line")
+	}
+	var settings map[string]interface{}
+	err := yaml.Unmarshal([]byte(front), &settings)
+	if err != nil {
+		return nil, "", fmt.Errorf("front-matter: %w", err)
+	}
+	return settings, text, nil
+}
+
+// SetPromptDefaults applies the front-matter settings of the named prompt to the flags that
+// were not given, they win over the config files and environment, as the prompt was chosen
+func SetPromptDefaults(flags *pflag.FlagSet, name string, settings map[string]interface{}) error {
+	for key := range settings {
+		f := flags.Lookup(key)
+		if f == nil || !slices.Contains(pretextSettings, f.Name) {
+			return fmt.Errorf("prompt %s: %q cannot be set by a prompt, use %s", name, key, strings.Join(pretextSettings, ", "))
+		}
+	}
+	err := SetConfigDefaults(flags, settings, true, "prompt "+name)
+	if err != nil {
+		return err
+	}
+	Model = ResolveModel(Model)
+	return nil
+}
+
+// SearchPrompts prints the name and matching lines of every prompt,
+// embedded or in PromptDir, whose name or body matches term
+func SearchPrompts(term string) error {
+	pattern := "(?i)" + regexp.QuoteMeta(term)
+	if SearchRegex {
+		pattern = "(?i)" + term
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	sources := []fs.FS{}
+	sub, err := fs.Sub(predefined, "prompts")
+	if err != nil {
+		return err
+	}
+	sources = append(sources, sub)
+	if PromptDir != "" {
+		sources = append(sources, os.DirFS(PromptDir))
+	}
+
+	for _, src := range sources {
+		files, err := fs.ReadDir(src, ".")
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			if f.IsDir() {
+				continue
+			}
+			name := strings.TrimSuffix(f.Name(), ".txt")
+			contents, err := fs.ReadFile(src, f.Name())
+			if err != nil {
+				return err
+			}
+
+			var snippets []string
+			for _, line := range strings.Split(string(contents), "\n") {
+				if re.MatchString(line) {
+					snippets = append(snippets, snippet(line, 80))
+				}
+			}
+
+			if len(snippets) == 0 && !re.MatchString(name) {
+				continue
+			}
+
+			fmt.Println(name)
+			for _, s := range snippets {
+				fmt.Println("  " + s)
+			}
+		}
+	}
+
+	return nil
+}
+
+// snippet trims a line to at most n runes for display
+func snippet(line string, n int) string {
+	line = strings.TrimSpace(line)
+	r := []rune(line)
+	if len(r) > n {
+		return string(r[:n]) + "..."
+	}
+	return line
+}
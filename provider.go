@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// Provider is an API serving chat models, the messages are sent to
+// the --provider, and to each --fallback in turn when that fails.
+// Only chat goes through it, tools, assistants, code, and completion models
+// use the OpenAI client, and are refused or dropped for the other providers
+type Provider interface {
+	// Chat returns the opts.Count responses to the messages
+	Chat(ctx context.Context, messages []gpt3.ChatCompletionMessage, opts ChatOptions) ([]string, error)
+	// Stream writes the response to w as it is generated and returns the full text
+	Stream(ctx context.Context, messages []gpt3.ChatCompletionMessage, w io.Writer) (string, error)
+}
+
+// ChatOptions are the settings of a request that can differ from the flags,
+// like the short answer for a session title
+type ChatOptions struct {
+	MaxTokens int
+	Count     int
+}
+
+// chatFlags are the ChatOptions of the --tokens and --count
+func chatFlags() ChatOptions {
+	return ChatOptions{MaxTokens: MaxTokens, Count: Count}
+}
+
+// ChatProvider is the --provider, set up by ConfigureClient
+var ChatProvider Provider
+
+// Fallbacks are the provider:model pairs from --fallback
+var Fallbacks []string
+
+type fallback struct {
+	name     string
+	model    string
+	provider Provider
+}
+
+var fallbacks []fallback
+
+// NewProvider sets up the named provider, base replaces its API URL. The client is
+// pointed at openai and azure providers, when nil a new one is created, as for a fallback
+func NewProvider(name, base string, client *gpt3.Client) (Provider, error) {
+	switch name {
+	case "openai", "azure":
+		config, err := openaiConfig(name, base)
+		if err != nil {
+			return nil, err
+		}
+		if client == nil {
+			return &openaiProvider{gpt3.NewClientWithConfig(config)}, nil
+		}
+		*client = *gpt3.NewClientWithConfig(config)
+		apiBaseURL = config.BaseURL
+		if name == "azure" {
+			apiBaseURL += "/openai"
+		}
+		return &openaiProvider{client}, nil
+	case "anthropic":
+		return newAnthropicProvider(base, client != nil)
+	case "gemini":
+		return newGeminiProvider(base, client != nil)
+	}
+	return nil, fmt.Errorf("unknown --provider %q, use openai, azure, anthropic, or gemini", name)
+}
+
+// withFailover calls with the ChatProvider, then with each fallback until one succeeds.
+// The model and provider name are switched for each, so requests are made for the fallback model
+func withFailover(ctx context.Context, call func(p Provider) error) error {
+	err := call(ChatProvider)
+	if err == nil || len(fallbacks) == 0 {
+		return err
+	}
+
+	model, name := Model, ProviderName
+	defer func() { Model, ProviderName = model, name }()
+	for _, f := range fallbacks {
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s %s failed, trying %s %s: %v\n", ProviderName, Model, f.name, f.model, err)
+		Model, ProviderName = f.model, f.name
+		err = call(f.provider)
+		if err == nil {
+			LastModel = f.model
+			Logger.Info("failover", "provider", f.name, "model", f.model)
+			return nil
+		}
+	}
+	return err
+}
+
+// openaiProvider serves OpenAI models, from OpenAI, Azure, or a compatible server
+type openaiProvider struct {
+	client *gpt3.Client
+}
+
+func (p *openaiProvider) Chat(ctx context.Context, messages []gpt3.ChatCompletionMessage, opts ChatOptions) ([]string, error) {
+	req := newChatRequest(messages, opts)
+	resp, err := p.client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	LastUsage = resp.Usage
+	LastFingerprint = resp.SystemFingerprint
+	if len(resp.Choices) > 0 {
+		LastLogprobs = chatLogprobs(resp.Choices[0].LogProbs)
+	}
+
+	var r []string
+	for _, c := range resp.Choices {
+		r = append(r, c.Message.Content)
+	}
+	return r, nil
+}
+
+func (p *openaiProvider) Stream(ctx context.Context, messages []gpt3.ChatCompletionMessage, w io.Writer) (string, error) {
+	return streamChat(p.client, ctx, newChatRequest(messages, chatFlags()), w)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"golang.org/x/term"
+)
+
+// LineReader gives the interactive session its input, a line at a time after a prompt,
+// io.EOF ends the session
+type LineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// scannerReader reads lines that are piped or scripted,
+// echo prints each line after the prompt, as if it was typed
+type scannerReader struct {
+	scanner *bufio.Scanner
+	echo    bool
+}
+
+func NewScannerReader(r io.Reader, echo bool) LineReader {
+	return &scannerReader{scanner: bufio.NewScanner(r), echo: echo}
+}
+
+func (s *scannerReader) ReadLine(prompt string) (string, error) {
+	fmt.Print(prompt)
+	if !s.scanner.Scan() {
+		if s.echo {
+			fmt.Println()
+		}
+		if err := s.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	line := s.scanner.Text()
+	if s.echo {
+		fmt.Println(line)
+	}
+	return line, nil
+}
+
+// interrupted is set by a Ctrl+C, at the prompt or while waiting for a response,
+// a second one in a row on an empty line ends the session
+var interrupted bool
+
+// terminalReader edits lines on a terminal, with the arrow keys, Ctrl+W and Ctrl+U,
+// and up and down going through the lines of this and earlier sessions
+type terminalReader struct {
+	rl *readline.Instance
+}
+
+func (t *terminalReader) ReadLine(prompt string) (string, error) {
+	t.rl.SetPrompt(prompt)
+	for {
+		line, err := t.rl.Readline()
+		// Ctrl+C clears the line, as in a shell, Ctrl+D on an empty line quits
+		if err == readline.ErrInterrupt {
+			if line != "" {
+				interrupted = false
+				continue
+			}
+			if interrupted {
+				return "", io.EOF
+			}
+			interrupted = true
+			fmt.Fprintln(t.rl.Stderr(), "press Ctrl+C again or Ctrl+D to exit")
+			continue
+		}
+		interrupted = false
+		return line, err
+	}
+}
+
+func (t *terminalReader) Close() error {
+	return t.rl.Close()
+}
+
+// a question in a block between a line starting with """ and a line of just """ can span lines,
+// as can lines ending in a backslash
+const (
+	blockQuote   = `"""`
+	promptMore   = "... "
+	continueLine = `\`
+)
+
+// ReadQuestion reads the next question, joining the lines of a """ block or of
+// lines ending in a backslash, multiline reports it spanned lines, so it is never a command.
+// A block left open at the end of the input ends there
+func ReadQuestion(lines LineReader, prompt string) (question string, multiline bool, err error) {
+	line, err := lines.ReadLine(prompt)
+	if err != nil {
+		return "", false, err
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(line), blockQuote) {
+		// only a line of just the quotes ends the block, pasted code can end in """
+		block := []string{strings.TrimPrefix(strings.TrimSpace(line), blockQuote)}
+		for {
+			line, err = lines.ReadLine(promptMore)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", false, err
+			}
+			if strings.TrimSpace(line) == blockQuote {
+				break
+			}
+			block = append(block, line)
+		}
+		// keep the indentation of pasted code, but not the lines of the quotes
+		return strings.Trim(strings.Join(block, "\n"), "\n"), true, nil
+	}
+
+	var joined []string
+	for strings.HasSuffix(line, continueLine) {
+		joined = append(joined, strings.TrimSuffix(line, continueLine))
+		line, err = lines.ReadLine(promptMore)
+		if err == io.EOF {
+			return strings.Join(joined, "\n"), true, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+	}
+	if joined == nil {
+		return line, false, nil
+	}
+	return strings.Join(append(joined, line), "\n"), true, nil
+}
+
+// HistoryFile keeps the lines typed in interactive sessions
+func HistoryFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "chatgpt", "history")
+}
+
+// NewLineReader reads stdin with line editing when it is a terminal,
+// otherwise a line at a time as it is
+func NewLineReader() (LineReader, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return NewScannerReader(os.Stdin, false), nil
+	}
+
+	history := HistoryFile()
+	if history != "" {
+		os.MkdirAll(filepath.Dir(history), 0700)
+		// questions can hold secrets, so only the user reads them, also in files made before
+		f, err := os.OpenFile(history, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err == nil {
+			f.Close()
+			os.Chmod(history, 0600)
+		}
+	}
+	// stdin is not fd 0 after ReopenTTY, so the terminal is set up through it
+	var state *readline.State
+	cfg := &readline.Config{
+		HistoryFile:    history,
+		HistoryLimit:   1000,
+		Stdin:          os.Stdin,
+		FuncIsTerminal: func() bool { return true },
+		FuncMakeRaw: func() (err error) {
+			state, err = readline.MakeRaw(fd)
+			return err
+		},
+		FuncExitRaw: func() error {
+			if state == nil {
+				return nil
+			}
+			return readline.Restore(fd, state)
+		},
+		FuncGetWidth: func() int {
+			w, _, err := term.GetSize(fd)
+			if err != nil || w <= 0 {
+				return 80
+			}
+			return w
+		},
+	}
+	if PromptEchoStderr {
+		cfg.Stdout = os.Stderr
+	}
+	rl, err := readline.NewEx(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &terminalReader{rl: rl}, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// RedactRule replaces matches of Pattern with a [REDACTED:<Name>] placeholder
+type RedactRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+var defaultRedactRules = []RedactRule{
+	{"openai-key", regexp.MustCompile(`sk-[A-Za-z0-9_-]{20,}`)},
+	{"aws-access-key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-key", regexp.MustCompile(`(?i)aws_secret_access_key\s*[=:]\s*[A-Za-z0-9/+=]{40}`)},
+	{"github-token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+	{"private-key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"email", regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+}
+
+var redactRules []RedactRule
+
+// matches already reported, so interactive turns do not repeat them
+var redactSeen = map[string]bool{}
+
+// LoadRedactRules reads "<name> <regex>" lines, blank lines and # comments are skipped.
+// Without a file the default rules are used
+func LoadRedactRules(filename string) error {
+	if filename == "" {
+		redactRules = defaultRedactRules
+		return nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, expr, ok := strings.Cut(line, " ")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected '<name> <regex>'", filename, n)
+		}
+		re, err := regexp.Compile(strings.TrimSpace(expr))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", filename, n, err)
+		}
+		redactRules = append(redactRules, RedactRule{name, re})
+	}
+	return scanner.Err()
+}
+
+// Redact replaces secrets in text with placeholders,
+// reporting new matches on stderr without printing them
+func Redact(text string) string {
+	for _, rule := range redactRules {
+		count := 0
+		text = rule.Pattern.ReplaceAllStringFunc(text, func(m string) string {
+			if !redactSeen[m] {
+				redactSeen[m] = true
+				count++
+			}
+			return "[REDACTED:" + rule.Name + "]"
+		})
+		if count > 0 {
+			Notef("redacted %d %s match(es)\n", count, rule.Name)
+		}
+	}
+	return text
+}
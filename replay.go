@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// ReplayKey hashes everything that selects a response for a prompt
+func ReplayKey(prompt, question string) string {
+	mode := "completion"
+	if CodeMode {
+		mode = "code"
+	} else if EditMode {
+		mode = "edit"
+	} else if Chatting() {
+		mode = "chat"
+	}
+	// every request parameter is part of the key, so changing one records anew
+	// rather than replaying a response made with the old value
+	params, _ := json.Marshal(struct {
+		Provider, Model                    string
+		Count, MaxTokens, BestOf, Logprobs int
+		Temp, TopP, Pres, Freq             float64
+		Stop                               []string
+		Seed                               *int
+		Suffix, User                       string
+		Echo, JSONOutput                   bool
+		LogitBias                          map[string]int
+		Images                             []string
+	}{
+		ProviderName, Model,
+		Count, MaxTokens, BestOf, Logprobs,
+		Temp, TopP, PresencePenalty, FrequencyPenalty,
+		Stop,
+		seedParam(),
+		Suffix, User,
+		Echo, JSONOutput,
+		LogitBias,
+		Images,
+	})
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s", mode, params, prompt, question)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// GetReplayResponse returns the recorded responses for the prompt from ReplayDir,
+// calling the API and recording the result the first time a prompt is seen
+func GetReplayResponse(client *gpt3.Client, ctx context.Context, conv *Conversation, question string) ([]string, error) {
+	// chat models are keyed on the messages, so roles are part of the match
+	prompt := conv.Render(true)
+	if Chatting() {
+		b, err := json.Marshal(conv.Messages)
+		if err != nil {
+			return nil, err
+		}
+		prompt = string(b)
+	}
+	filename := filepath.Join(ReplayDir, ReplayKey(prompt, question)+".json")
+
+	var R []string
+	content, err := os.ReadFile(filename)
+	if err == nil {
+		err = json.Unmarshal(content, &R)
+		if err != nil {
+			return nil, fmt.Errorf("reading recording %s: %w", filename, err)
+		}
+		return R, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if ReplayOnly {
+		return nil, fmt.Errorf("no recorded response for this prompt in %s", ReplayDir)
+	}
+
+	R, err = getLiveResponse(client, ctx, conv, question)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err = json.MarshalIndent(R, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(ReplayDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return R, os.WriteFile(filename, content, 0644)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// the first wait before a retry, doubled after each, up to maxBackoff
+const (
+	baseBackoff = 500 * time.Millisecond
+	maxBackoff  = 30 * time.Second
+)
+
+// RequestRetries is the --request-retries, how many times a failed request is sent again
+var RequestRetries int
+
+// retryTransport sends a request again after transient failures, rate limits,
+// server errors, and dropped connections, waiting longer each time
+type retryTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	for attempt := 1; attempt <= RequestRetries; attempt++ {
+		reason, ok := transient(resp, err)
+		if !ok || (req.Body != nil && req.GetBody == nil) {
+			break
+		}
+
+		wait := backoff(attempt, resp)
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		Notef("request failed (%s), retrying in %s\n", reason, wait.Round(time.Millisecond))
+		Logger.Warn("retrying request", "attempt", attempt, "request_retries", RequestRetries, "reason", reason, "wait", wait)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+
+		retry := req.Clone(req.Context())
+		if req.GetBody != nil {
+			retry.Body, err = req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+		resp, err = t.base.RoundTrip(retry)
+	}
+	return resp, err
+}
+
+// transient reports whether a failed request may succeed when sent again, and why it failed
+func transient(resp *http.Response, err error) (string, bool) {
+	if err != nil {
+		var timeout interface{ Timeout() bool }
+		// --timeout is the limit of the whole request, a retry would start it over
+		if errors.As(err, new(errTimeout)) {
+			return "", false
+		}
+		if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return "connection reset", true
+		}
+		// a missing host or refused connection will not fix itself in a few seconds
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			return err.Error(), dnsErr.IsTimeout || dnsErr.IsTemporary
+		}
+		if errors.As(err, &timeout) && timeout.Timeout() {
+			return "timeout", true
+		}
+		return "", false
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		// running out of credit is reported as a rate limit too
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(b))
+		return resp.Status, !bytes.Contains(b, []byte("insufficient_quota"))
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return resp.Status, true
+	}
+	return "", false
+}
+
+// backoff is how long to wait before a retry, the Retry-After of the response
+// when it gives one, otherwise doubling with each attempt, with jitter so
+// concurrent requests do not all retry at once
+func backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s >= 0 {
+			return min(time.Duration(s)*time.Second, maxBackoff)
+		}
+	}
+	d := min(baseBackoff<<(attempt-1), maxBackoff)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
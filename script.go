@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// RunScript runs the turns in filename through the interactive loop
+func RunScript(client *gpt3.Client, filename string) error {
+	_, err := runScriptFile(client, filename)
+	return err
+}
+
+// runScriptFile reports whether the script ended the session with 'quit'.
+// Blank lines and lines starting with # are skipped
+func runScriptFile(client *gpt3.Client, filename string) (bool, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+
+	var turns []string
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		turns = append(turns, line)
+	}
+
+	return RunSession(client, NewScannerReader(strings.NewReader(strings.Join(turns, "\n")), true))
+}
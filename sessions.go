@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+var DiffMarkdown bool
+
+// RetryLast is the --retry-last, a saved session to ask the last question of again
+var RetryLast string
+
+var sessionTitle string // generated once, for saves without a name
+
+// SessionTitle asks the model for a short title of the Session,
+// reusing the first one for the rest of the session
+func SessionTitle(client *gpt3.Client, ctx context.Context) (string, error) {
+	if sessionTitle != "" {
+		return sessionTitle, nil
+	}
+
+	err := CheckBudget()
+	if err != nil {
+		return "", err
+	}
+
+	conv := Session.Copy()
+	conv.Add(UserMessage("Give this conversation a short title, at most six words. Reply with only the title."))
+
+	if RedactPrompt {
+		conv.Redact()
+	}
+
+	// edit and code models cannot write a title, so the chat default is used
+	model := Model
+	if ModelFamily(model) == "edit" || CodeMode || EditMode {
+		model = gpt3.GPT3Dot5Turbo
+	}
+
+	var text string
+	if _, ok := ChatProvider.(*openaiProvider); !ok {
+		// the other providers only have chat models, so the title comes from the --model
+		r, err := ChatProvider.Chat(ctx, conv.Messages, ChatOptions{MaxTokens: 16, Count: 1})
+		if err != nil {
+			return "", err
+		}
+		RecordSpend(Model, LastUsage)
+		text = r[0]
+	} else if family := ModelFamily(model); family == "chat" || family == "reasoning" {
+		req := gpt3.ChatCompletionRequest{
+			Model:    model,
+			Messages: conv.Messages,
+			User:     User,
+		}
+		// reasoning models need room to think before the title
+		if family == "chat" {
+			req.MaxTokens = 16
+		}
+		resp, err := client.CreateChatCompletion(ctx, req)
+		if err != nil {
+			return "", err
+		}
+		RecordSpend(model, resp.Usage)
+		if len(resp.Choices) == 0 {
+			return "", fmt.Errorf("no title in the response")
+		}
+		text = resp.Choices[0].Message.Content
+	} else {
+		req := gpt3.CompletionRequest{
+			Model:     model,
+			MaxTokens: 16,
+			Prompt:    conv.Render(true),
+			User:      User,
+		}
+		resp, err := client.CreateCompletion(ctx, req)
+		if err != nil {
+			return "", err
+		}
+		if resp.Usage != nil {
+			RecordSpend(model, *resp.Usage)
+		}
+		if len(resp.Choices) == 0 {
+			return "", fmt.Errorf("no title in the response")
+		}
+		text = resp.Choices[0].Text
+	}
+
+	title := Slugify(text)
+	if title == "" {
+		return "", fmt.Errorf("the title %q has no usable characters", text)
+	}
+	sessionTitle = title
+	return title, nil
+}
+
+// Slugify lower cases s and joins its words with dashes, for use as a filename
+func Slugify(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	slug := []rune(strings.Join(words, "-"))
+	if len(slug) > 60 {
+		slug = slug[:60]
+	}
+	return strings.TrimRight(string(slug), "-")
+}
+
+// SaveSession writes the conversation, as messages when the filename
+// ends in .json, otherwise as the rendered transcript
+func SaveSession(c *Conversation, filename string) error {
+	if filepath.Ext(filename) == ".json" {
+		b, err := json.MarshalIndent(c.Messages, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeSession(filename, b)
+	}
+	return writeSession(filename, []byte(c.Render(false)))
+}
+
+// writeSession replaces the file in one step, so a failed write keeps the session it had
+func writeSession(filename string, content []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), ".session-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(content)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// LoadSession reads a saved session. Transcripts are split into turns
+// on the '> ' lines which start each question
+func LoadSession(filename string) (Conversation, error) {
+	var c Conversation
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return c, err
+	}
+
+	if filepath.Ext(filename) == ".json" {
+		err = json.Unmarshal(b, &c.Messages)
+		if err != nil {
+			return c, fmt.Errorf("reading session %s: %w", filename, err)
+		}
+		return c, nil
+	}
+
+	var question string
+	var body []string
+	flush := func() {
+		text := strings.TrimSpace(strings.Join(body, "\n"))
+		if question == "" {
+			// the context the session started with
+			if text != "" {
+				c.Add(UserMessage(text))
+				c.initial = 1
+			}
+		} else {
+			c.Add(UserMessage(question), AssistantMessage(text))
+		}
+		body = nil
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "> ") {
+			flush()
+			question = strings.TrimPrefix(line, "> ")
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+	return c, nil
+}
+
+// RetryLastSession asks the last question of a saved session again,
+// then saves the session with the new response in place of the old one
+func RetryLastSession(client *gpt3.Client, filename string) error {
+	// only one response can take the place of the old one
+	if Count > 1 {
+		return fmt.Errorf("--retry-last makes one response, --count %d is not supported", Count)
+	}
+	c, err := LoadSession(filename)
+	if err != nil {
+		return err
+	}
+	if !c.DropAnswer() {
+		return fmt.Errorf("%s has no question to ask again", filename)
+	}
+	Session = c
+
+	ctx := context.Background()
+	err = CheckModeration(client, ctx, &Session)
+	if err != nil {
+		return err
+	}
+	var final string
+	if Streaming() {
+		final, err = GetStreamResponse(client, ctx, &Session, os.Stdout)
+		fmt.Println()
+	} else {
+		var R []string
+		R, err = GetResponse(client, ctx, &Session, Question)
+		if err == nil {
+			final = JoinResponses(R)
+			fmt.Println(TruncateLines(final))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	Session.Add(AssistantMessage(strings.TrimSpace(final)))
+	return SaveSession(&Session, filename)
+}
+
+// turns pairs each question with the reply to it
+func (c *Conversation) turns() [][2]string {
+	var t [][2]string
+	for i, m := range c.Messages {
+		if m.Role != gpt3.ChatMessageRoleAssistant {
+			continue
+		}
+		q := ""
+		if i > 0 && c.Messages[i-1].Role == gpt3.ChatMessageRoleUser {
+			q = c.Messages[i-1].Content
+		}
+		t = append(t, [2]string{q, m.Content})
+	}
+	return t
+}
+
+func NewSessionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "work with saved sessions",
+	}
+
+	diff := &cobra.Command{
+		Use:   "diff <a> <b>",
+		Short: "compare the responses of two saved sessions",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := DiffSessions(args[0], args[1])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+	diff.Flags().BoolVarP(&DiffMarkdown, "markdown", "", false, "format the diff as markdown")
+
+	cmd.AddCommand(diff)
+	return cmd
+}
+
+// DiffSessions prints a unified diff of the responses turn by turn,
+// noting the first turn where the conversations diverge
+func DiffSessions(a, b string) error {
+	ca, err := LoadSession(a)
+	if err != nil {
+		return err
+	}
+	cb, err := LoadSession(b)
+	if err != nil {
+		return err
+	}
+	ta, tb := ca.turns(), cb.turns()
+
+	n := len(ta)
+	if len(tb) > n {
+		n = len(tb)
+	}
+
+	diverged := false
+	for i := 0; i < n; i++ {
+		var qa, ra, qb, rb string
+		if i < len(ta) {
+			qa, ra = ta[i][0], ta[i][1]
+		}
+		if i < len(tb) {
+			qb, rb = tb[i][0], tb[i][1]
+		}
+		if qa == qb && ra == rb {
+			continue
+		}
+
+		if !diverged {
+			diverged = true
+			if DiffMarkdown {
+				fmt.Printf("**conversations diverge at turn %d**\n\n", i+1)
+			} else {
+				fmt.Printf("conversations diverge at turn %d\n\n", i+1)
+			}
+		}
+
+		q := qa
+		if qa != qb {
+			q = qa + " | " + qb
+		}
+		lines := DiffLines(ra, rb)
+		if DiffMarkdown {
+			fmt.Printf("### Turn %d\n\n> %s\n\n```diff\n--- %s\n+++ %s\n%s```\n\n", i+1, q, a, b, lines)
+		} else {
+			fmt.Printf("turn %d: > %s\n--- %s\n+++ %s\n%s\n", i+1, q, a, b, lines)
+		}
+	}
+
+	if !diverged {
+		fmt.Println("sessions have the same responses")
+	}
+	return nil
+}
+
+// DiffLines returns a line diff of a and b, using the longest common subsequence
+func DiffLines(a, b string) string {
+	la, lb := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	// lcs[i][j] is the common length of la[i:] and lb[j:]
+	lcs := make([][]int, len(la)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(lb)+1)
+	}
+	for i := len(la) - 1; i >= 0; i-- {
+		for j := len(lb) - 1; j >= 0; j-- {
+			if la[i] == lb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(la) && j < len(lb) {
+		switch {
+		case la[i] == lb[j]:
+			sb.WriteString(" " + la[i] + "\n")
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			sb.WriteString("-" + la[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+" + lb[j] + "\n")
+			j++
+		}
+	}
+	for ; i < len(la); i++ {
+		sb.WriteString("-" + la[i] + "\n")
+	}
+	for ; j < len(lb); j++ {
+		sb.WriteString("+" + lb[j] + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// SettingSources records where flag values came from, when not the command line or default
+var SettingSources = map[string]string{}
+
+// flags that take their default from an environment variable
+var envFlags = [][2]string{
+	{"prompt-dir", "CHATGPT_PROMPT_DIR"},
+	{"model", "CHATGPT_MODEL"},
+	{"user", "CHATGPT_USER"},
+	{"temp", "CHATGPT_TEMPERATURE"},
+	{"topp", "CHATGPT_TOP_P"},
+	{"pres", "CHATGPT_PRESENCE_PENALTY"},
+	{"freq", "CHATGPT_FREQUENCY_PENALTY"},
+	{"org", "OPENAI_ORG_ID"},
+	{"project", "OPENAI_PROJECT_ID"},
+}
+
+// flagAliases lets flags also be given by the API parameter name
+var flagAliases = map[string]string{
+	"temperature":       "temp",
+	"top-p":             "topp",
+	"presence-penalty":  "pres",
+	"frequency-penalty": "freq",
+	"n":                 "count",
+	"pretext":           "prompt",
+}
+
+// NormalizeFlag resolves flag aliases, for pflag.FlagSet.SetNormalizeFunc
+func NormalizeFlag(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	if alias, ok := flagAliases[name]; ok {
+		name = alias
+	}
+	return pflag.NormalizedName(name)
+}
+
+// EnvName is the variable for a flag or alias, like CHATGPT_MAX_RETRIES for --max-retries
+func EnvName(name string) string {
+	return "CHATGPT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// SetEnvDefaults applies the envFlags, then the variables of the aliases, then one for
+// every other flag named by EnvName, to the flags that were not given.
+// The first variable that is set for a flag wins
+func SetEnvDefaults(flags *pflag.FlagSet) error {
+	vars := append([][2]string{}, envFlags...)
+	var aliases []string
+	for alias := range flagAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		vars = append(vars, [2]string{flagAliases[alias], EnvName(alias)})
+	}
+	flags.VisitAll(func(f *pflag.Flag) {
+		// the config file is read before the environment, see configFile
+		if f.Name != "help" && f.Name != "config" {
+			vars = append(vars, [2]string{f.Name, EnvName(f.Name)})
+		}
+	})
+
+	set := map[string]bool{}
+	for _, e := range vars {
+		if set[e[0]] || os.Getenv(e[1]) == "" {
+			continue
+		}
+		err := SetFromEnv(flags, e[0], e[1])
+		if err != nil {
+			return err
+		}
+		set[e[0]] = true
+	}
+	return nil
+}
+
+// SetFromEnv applies an environment variable to a flag that was not given
+func SetFromEnv(flags *pflag.FlagSet, name, env string) error {
+	f := flags.Lookup(name)
+	v := os.Getenv(env)
+	if f == nil || f.Changed || v == "" {
+		return nil
+	}
+	err := f.Value.Set(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", env, err)
+	}
+	SettingSources[name] = envSource(env)
+	return nil
+}
+
+// PrintConfig prints every setting, its value, and where the value came from
+func PrintConfig(flags *pflag.FlagSet) {
+	var names []string
+	values := map[string]string{}
+	sources := map[string]string{}
+
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Name == "help" || f.Name == "show-config" {
+			return
+		}
+		names = append(names, f.Name)
+		values[f.Name] = f.Value.String()
+		switch {
+		case SettingSources[f.Name] != "":
+			sources[f.Name] = SettingSources[f.Name]
+		case f.Changed:
+			sources[f.Name] = "flag"
+		default:
+			sources[f.Name] = "default"
+		}
+	})
+
+	names = append(names, "api-key")
+	values["api-key"] = RedactKey(clientKey)
+	sources["api-key"] = apiKeySource
+	if clientKey == "" {
+		values["api-key"], sources["api-key"] = "", "none"
+	}
+
+	sort.Strings(names)
+	width := 0
+	for _, n := range names {
+		if len(n) > width {
+			width = len(n)
+		}
+	}
+	for _, n := range names {
+		fmt.Printf("%-*s  %-20s  %s\n", width, n, values[n], sources[n])
+	}
+}
+
+// RedactKey keeps just enough of a key to tell which one it is
+func RedactKey(key string) string {
+	if len(key) < 12 {
+		return "****"
+	}
+	return key[:3] + "..." + key[len(key)-4:]
+}
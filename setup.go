@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// NeedsSetup reports whether this is the first run, with no key and no config file,
+// on a terminal where the setup questions can be answered
+func NeedsSetup() bool {
+	if clientKey != "" || ProviderName != "openai" || APIBase != "" || os.Getenv("CHATGPT_API_BASE") != "" {
+		return false
+	}
+	if _, err := os.Stat(configFile()); err == nil {
+		return false
+	}
+	return !StdinPiped() && term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// RunSetup asks for the API key and the default model, checks both with the API,
+// then stores the key and writes the config file, so the command can go on
+func RunSetup(cmd *cobra.Command, client *gpt3.Client) error {
+	fmt.Fprintln(os.Stderr, "No API key or config file was found, answer a few questions to set them up.")
+	fmt.Fprintln(os.Stderr, "Get a key at https://platform.openai.com/account/api-keys")
+
+	var models []string
+	for {
+		key, err := readSecret("API key: ")
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			return errNoKey()
+		}
+		clientKey, apiKeySource = key, "setup"
+		models, err = setupModels(client)
+		var apiErr *gpt3.APIError
+		if errors.As(err, &apiErr) && apiErr.HTTPStatusCode == http.StatusUnauthorized {
+			fmt.Fprintf(os.Stderr, "the key was rejected: %s\n", apiErr.Message)
+			continue
+		}
+		if err != nil {
+			// the key may still be fine, the models are only checked when they could be listed
+			fmt.Fprintf(os.Stderr, "warning: could not check the key: %v\n", err)
+		}
+		break
+	}
+
+	model := Model
+	for {
+		fmt.Fprintf(os.Stderr, "default model [%s]: ", Model)
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return err
+		}
+		model = strings.TrimSpace(line)
+		if model == "" {
+			model = Model
+		}
+		err = ValidateModel(model)
+		if err == nil && models != nil && !slices.Contains(models, model) {
+			err = fmt.Errorf("%s is not one of the models your key can use, see 'chatgpt models'", model)
+		}
+		if err == nil {
+			break
+		}
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	stored := false
+	if confirm("store the key in the system keyring?") {
+		err := keyring.Set(keyringService, keyringAccount(ProviderName), clientKey)
+		if err == nil {
+			stored = true
+			apiKeySource = "keyring"
+		} else {
+			fmt.Fprintf(os.Stderr, "warning: storing the key in the keyring: %v\n", err)
+		}
+	}
+	if !stored {
+		filename := DefaultKeyFile()
+		err := writeKeyFile(filename, clientKey)
+		if err != nil {
+			return err
+		}
+		apiKeySource = "file " + filename
+		fmt.Fprintf(os.Stderr, "stored the key in %s\n", filename)
+	}
+
+	filename := configFile()
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{
+		Kind: yaml.MappingNode,
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "model"},
+			{Kind: yaml.ScalarNode, Value: model},
+		},
+	}}}
+	b, err := marshalConfig(doc)
+	if err != nil {
+		return err
+	}
+	err = writeConfig(filename, b)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %s, change it with 'chatgpt config'\n\n", filename)
+
+	if f := cmd.Flag("model"); f != nil && !f.Changed {
+		Model = model
+		SettingSources["model"] = "config " + filename
+	}
+	return nil
+}
+
+// setupModels checks the key by listing the models it can use
+func setupModels(client *gpt3.Client) ([]string, error) {
+	err := ConfigureClient(client)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	list, err := client.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, m := range list.Models {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// writeKeyFile stores the key where only the user can read it,
+// replacing the file in one step so a failed write keeps the old key
+func writeKeyFile(filename, key string) error {
+	err := os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), ".key-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(key + "\n")
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+var SpeakModel string
+var SpeakVoice string
+var SpeakFormat string
+var SpeakOutput string
+var SpeakSession string
+var SpeakPlay bool
+
+func NewSpeakCmd(client *gpt3.Client) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "speak [text...]",
+		Short: "read text aloud with the TTS endpoint, from the arguments, stdin, or the last response of a session",
+		Run: func(cmd *cobra.Command, args []string) {
+			text, err := speakText(args)
+			if err == nil {
+				err = Speak(client, context.Background(), text)
+			}
+			if err != nil {
+				PrintError(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&SpeakModel, "model", "m", string(gpt3.TTSModel1), "select the speech model")
+	cmd.Flags().StringVarP(&SpeakVoice, "voice", "v", string(gpt3.VoiceAlloy), "voice to speak with, like alloy, echo, fable, onyx, nova, or shimmer")
+	cmd.Flags().StringVarP(&SpeakFormat, "format", "f", string(gpt3.SpeechResponseFormatMp3), "audio format: mp3, opus, aac, flac, wav, or pcm")
+	cmd.Flags().StringVarP(&SpeakOutput, "output", "o", "", "file to write the audio to, defaults to the first free speech-<n>.<format>, or a temporary file with --play")
+	cmd.Flags().StringVarP(&SpeakSession, "session", "", "", "speak the last response of this saved session")
+	cmd.Flags().BoolVarP(&SpeakPlay, "play", "", false, "play the audio once written, with the first of afplay, ffplay, mpv, or aplay found")
+
+	return cmd
+}
+
+// speakText takes the text from the arguments, a session, or stdin, in that order
+func speakText(args []string) (string, error) {
+	if len(args) > 0 {
+		return strings.Join(args, " "), nil
+	}
+	if SpeakSession != "" {
+		c, err := LoadSession(SpeakSession)
+		if err != nil {
+			return "", err
+		}
+		return LastResponse(&c)
+	}
+	return ReadStdin()
+}
+
+// LastResponse returns the content of the last assistant message
+func LastResponse(c *Conversation) (string, error) {
+	for i := len(c.Messages) - 1; i >= 0; i-- {
+		if c.Messages[i].Role == gpt3.ChatMessageRoleAssistant {
+			return c.Messages[i].Content, nil
+		}
+	}
+	return "", fmt.Errorf("there is no response to speak yet")
+}
+
+// Speak writes the text as audio to SpeakOutput, then plays it with --play
+func Speak(client *gpt3.Client, ctx context.Context, text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fmt.Errorf("there is no text to speak")
+	}
+
+	err := CheckBudget()
+	if err != nil {
+		return err
+	}
+	resp, err := client.CreateSpeech(ctx, gpt3.CreateSpeechRequest{
+		Model:          gpt3.SpeechModel(SpeakModel),
+		Input:          text,
+		Voice:          gpt3.SpeechVoice(SpeakVoice),
+		ResponseFormat: gpt3.SpeechResponseFormat(SpeakFormat),
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	// priced by the character, which stand in for the prompt tokens
+	RecordSpend(SpeakModel, gpt3.Usage{PromptTokens: utf8.RuneCountInString(text)})
+
+	// played audio is not kept unless --output is given, and files are not overwritten unless named
+	var f *os.File
+	switch {
+	case SpeakOutput != "":
+		f, err = os.Create(SpeakOutput)
+	case SpeakPlay:
+		f, err = os.CreateTemp("", "chatgpt-speech-*."+SpeakFormat)
+		if err == nil {
+			defer os.Remove(f.Name())
+		}
+	default:
+		var path string
+		path, err = freeName("speech", "."+SpeakFormat)
+		if err == nil {
+			f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, resp)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if SpeakOutput != "" || !SpeakPlay {
+		fmt.Println(f.Name())
+	}
+
+	if SpeakPlay {
+		return PlayAudio(f.Name())
+	}
+	return nil
+}
+
+// audio players to try, with the arguments to play a file once without a window
+var audioPlayers = [][]string{
+	{"afplay"},
+	{"ffplay", "-nodisp", "-autoexit", "-loglevel", "quiet"},
+	{"mpv", "--no-video", "--really-quiet"},
+	{"aplay", "-q"},
+}
+
+// PlayAudio plays the file with the first player found on the PATH
+func PlayAudio(path string) error {
+	for _, p := range audioPlayers {
+		if _, err := exec.LookPath(p[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(p[0], append(p[1:], path)...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		return cmd.Run()
+	}
+	return fmt.Errorf("no audio player found, install one of afplay, ffplay, mpv, or aplay")
+}
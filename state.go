@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// BatchState tracks the finished entries of a manifest, so an interrupted run can be resumed
+type BatchState struct {
+	// hash of the manifest the state belongs to
+	Manifest string `json:"manifest"`
+	// entry index to the hash of its file when it was processed
+	Done map[int]string `json:"done"`
+
+	filename string
+}
+
+func hashFile(filename string) (string, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// LoadBatchState reads the state next to manifest when resuming,
+// otherwise it starts a new state which replaces any old one
+func LoadBatchState(manifest string, resume bool) (*BatchState, error) {
+	hash, err := hashFile(manifest)
+	if err != nil {
+		return nil, err
+	}
+	s := &BatchState{Manifest: hash, Done: map[int]string{}, filename: manifest + ".state"}
+	if !resume {
+		return s, nil
+	}
+
+	b, err := os.ReadFile(s.filename)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var old BatchState
+	err = json.Unmarshal(b, &old)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", s.filename, err)
+	}
+	if old.Manifest != hash {
+		return nil, fmt.Errorf("%s was changed since %s was written, remove it to start over", manifest, s.filename)
+	}
+	if old.Done != nil {
+		s.Done = old.Done
+	}
+	return s, nil
+}
+
+// Finished reports whether entry i was processed with the current content of file
+func (s *BatchState) Finished(i int, file string) bool {
+	h, ok := s.Done[i]
+	if !ok {
+		return false
+	}
+	cur, err := hashFile(file)
+	return err == nil && cur == h
+}
+
+// MarkDone records entry i and saves the state
+func (s *BatchState) MarkDone(i int, file string) error {
+	h, err := hashFile(file)
+	if err != nil {
+		return err
+	}
+	s.Done[i] = h
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.filename, b, 0644)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// StdinPiped reports whether stdin is a pipe or file rather than a terminal
+func StdinPiped() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// StdinFIFO reports whether stdin is a pipe from another command, and not a file
+// redirected in, like the list a 'while read' loop is reading, or a terminal
+func StdinFIFO() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeNamedPipe != 0
+}
+
+// StdoutPiped reports whether stdout is a pipe or file rather than a terminal
+func StdoutPiped() bool {
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// ReadStdin reads all of stdin as context
+func ReadStdin() (string, error) {
+	b, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	if ForceUTF8 {
+		return ToUTF8(b), nil
+	}
+	return string(b), nil
+}
+
+// ReopenTTY points stdin at the terminal, after piped input has been consumed,
+// so an interactive session can still read what is typed
+func ReopenTTY() error {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return err
+	}
+	os.Stdin = tty
+	return nil
+}
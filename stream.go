@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// Streaming reports whether responses can be printed as they arrive.
+// Edits, several choices, replays, validation, truncation, logprobs, best-of, tools, and assistants need the whole response
+func Streaming() bool {
+	return !NoStream && !EditMode && Count == 1 && ReplayDir == "" && !Validating() && MaxLines == 0 &&
+		Logprobs == 0 && BestOf == 0 && len(Tools) == 0 && AssistantID == ""
+}
+
+// GetStreamResponse writes the response to the conversation to w as it is generated
+// and returns the full text
+func GetStreamResponse(client *gpt3.Client, ctx context.Context, conv *Conversation, w io.Writer) (string, error) {
+	c := conv.Copy()
+	if RedactPrompt {
+		c.Redact()
+	}
+	LastUsage = gpt3.Usage{}
+	LastModel = Model
+	LastFingerprint = ""
+	err := CheckBudget()
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	var text, prompt string
+	if Chatting() {
+		var partial error
+		err = withFailover(ctx, func(p Provider) error {
+			var serr error
+			text, serr = p.Stream(ctx, c.Messages, w)
+			// another model would repeat what was already printed
+			if serr != nil && text != "" {
+				partial = serr
+				return nil
+			}
+			return serr
+		})
+		if partial != nil {
+			err = partial
+		}
+		for _, m := range c.Messages {
+			prompt += m.Content + "\n"
+		}
+	} else {
+		model := Model
+		if CodeMode {
+			model = gpt3.CodexCodeDavinci002
+		}
+		prompt = c.Render(true)
+		text, err = streamCompletion(client, ctx, newCompletionRequest(model, prompt), w)
+	}
+
+	// the stream carries no usage, so it is estimated
+	if LastUsage.TotalTokens == 0 {
+		LastUsage.PromptTokens = EstimateTokens(prompt)
+		LastUsage.CompletionTokens = EstimateTokens(text)
+		LastUsage.TotalTokens = LastUsage.PromptTokens + LastUsage.CompletionTokens
+	}
+	logRequest("stream", start, err)
+	RecordSpend(LastModel, LastUsage)
+	return text, err
+}
+
+func streamCompletion(client *gpt3.Client, ctx context.Context, req gpt3.CompletionRequest, w io.Writer) (string, error) {
+	stream, err := client.CreateCompletionStream(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	text := ""
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return text, nil
+		}
+		if err != nil {
+			return text, err
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+		fmt.Fprint(w, resp.Choices[0].Text)
+		text += resp.Choices[0].Text
+	}
+}
+
+func streamChat(client *gpt3.Client, ctx context.Context, req gpt3.ChatCompletionRequest, w io.Writer) (string, error) {
+	stream, err := client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	text := ""
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return text, nil
+		}
+		if err != nil {
+			return text, err
+		}
+		if resp.SystemFingerprint != "" {
+			LastFingerprint = resp.SystemFingerprint
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+		fmt.Fprint(w, resp.Choices[0].Delta.Content)
+		text += resp.Choices[0].Delta.Content
+	}
+}
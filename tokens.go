@@ -0,0 +1,6 @@
+package main
+
+// EstimateTokens roughly counts tokens, at about 4 characters per token for English text
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+	"gopkg.in/yaml.v3"
+)
+
+// Tool is a function the model can call, which is run locally
+type Tool struct {
+	Name        string                 `yaml:"name"`
+	Description string                 `yaml:"description"`
+	Parameters  map[string]interface{} `yaml:"parameters,omitempty"`
+	// run with sh -c, given the arguments of the call as JSON on stdin
+	Command string `yaml:"command,omitempty"`
+	// ask before running each call
+	Confirm bool `yaml:"confirm,omitempty"`
+
+	run       func(args map[string]interface{}) (string, error) // for built-in tools
+	confirmIf func(args map[string]interface{}) bool            // for built-in tools asking only about some calls
+}
+
+// the most tool calls answered before the model must respond,
+// so a confused model cannot loop forever
+const maxToolRounds = 8
+
+// tool output is cut to this, so one call cannot fill the context
+const maxToolOutput = 32 * 1024
+
+// Tools are the tools offered to chat models, set up by LoadTools
+var Tools []Tool
+
+func stringParam(name, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			name: map[string]interface{}{"type": "string", "description": description},
+		},
+		"required": []string{name},
+	}
+}
+
+var builtinTools = []Tool{
+	{
+		Name:        "shell",
+		Description: "Run a shell command and return its combined output. The user confirms each command.",
+		Parameters:  stringParam("command", "the command for sh -c"),
+		Confirm:     true,
+		run: func(args map[string]interface{}) (string, error) {
+			out, err := exec.Command("sh", "-c", fmt.Sprint(args["command"])).CombinedOutput()
+			return string(out), err
+		},
+	},
+	{
+		Name:        "read_file",
+		Description: "Read a local file and return its contents. The user confirms files outside the working directory.",
+		Parameters:  stringParam("path", "the path of the file"),
+		confirmIf: func(args map[string]interface{}) bool {
+			return !inWorkingDir(fmt.Sprint(args["path"]))
+		},
+		run: func(args map[string]interface{}) (string, error) {
+			b, err := os.ReadFile(fmt.Sprint(args["path"]))
+			return string(b), err
+		},
+	},
+	{
+		Name:        "http_get",
+		Description: "Fetch a URL with an HTTP GET and return the response body. The user confirms each URL.",
+		Parameters:  stringParam("url", "the URL to fetch"),
+		Confirm:     true,
+		run: func(args map[string]interface{}) (string, error) {
+			resp, err := toolHTTPClient.Get(fmt.Sprint(args["url"]))
+			if err != nil {
+				return "", err
+			}
+			defer resp.Body.Close()
+			b, err := io.ReadAll(io.LimitReader(resp.Body, maxToolOutput+1))
+			if resp.StatusCode >= 300 {
+				return string(b), fmt.Errorf("%s", resp.Status)
+			}
+			return string(b), err
+		},
+	},
+}
+
+// toolHTTPClient fetches for http_get through the --proxy, --ca-cert, and --timeout of the API
+var toolHTTPClient = &http.Client{Transport: &timeoutTransport{base: apiTransport}}
+
+// inWorkingDir reports whether the path, after following links, is in the working directory
+func inWorkingDir(path string) bool {
+	wd, err := os.Getwd()
+	if err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	// a file that does not exist is not read anyway
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(wd); err == nil {
+		wd = resolved
+	}
+	rel, err := filepath.Rel(wd, abs)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// LoadTools sets up the built-in tools, when enabled, and those declared
+// in the yaml file as a list of {name, description, parameters, command, confirm}
+func LoadTools(builtins bool, filename string) error {
+	Tools = nil
+	if builtins {
+		Tools = append(Tools, builtinTools...)
+	}
+	if filename == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var declared []Tool
+	err = yaml.Unmarshal(content, &declared)
+	if err != nil {
+		return fmt.Errorf("reading tools %s: %w", filename, err)
+	}
+	for _, t := range declared {
+		if t.Name == "" || t.Command == "" {
+			return fmt.Errorf("reading tools %s: every tool needs a name and a command", filename)
+		}
+		if t.Parameters == nil {
+			t.Parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		Tools = append(Tools, t)
+	}
+	return nil
+}
+
+func apiTools() []gpt3.Tool {
+	var r []gpt3.Tool
+	for _, t := range Tools {
+		r = append(r, gpt3.Tool{
+			Type: gpt3.ToolTypeFunction,
+			Function: &gpt3.FunctionDefinition{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
+	}
+	return r
+}
+
+// CallTool runs one tool call from the model, errors are returned
+// to the model as the result, so it can recover from them
+func CallTool(call gpt3.ToolCall) string {
+	var tool *Tool
+	for i := range Tools {
+		if Tools[i].Name == call.Function.Name {
+			tool = &Tools[i]
+		}
+	}
+	if tool == nil {
+		return fmt.Sprintf("error: there is no tool named %q", call.Function.Name)
+	}
+
+	args := map[string]interface{}{}
+	if call.Function.Arguments != "" {
+		err := json.Unmarshal([]byte(call.Function.Arguments), &args)
+		if err != nil {
+			return fmt.Sprintf("error: the arguments are not a JSON object: %v", err)
+		}
+	}
+
+	ask := tool.Confirm || (tool.confirmIf != nil && tool.confirmIf(args))
+	if ask && !confirm(fmt.Sprintf("run tool %s %s?", tool.Name, call.Function.Arguments)) {
+		return "error: the user declined to run this"
+	}
+	Notef("tool %s %s\n", tool.Name, call.Function.Arguments)
+
+	var out string
+	var err error
+	if tool.run != nil {
+		out, err = tool.run(args)
+	} else {
+		cmd := exec.Command("sh", "-c", tool.Command)
+		cmd.Stdin = strings.NewReader(call.Function.Arguments)
+		var b []byte
+		b, err = cmd.CombinedOutput()
+		out = string(b)
+	}
+	Logger.Info("tool call", "tool", tool.Name, "error", err != nil)
+
+	if len(out) > maxToolOutput {
+		out = out[:maxToolOutput] + "\n… (truncated)"
+	}
+	if err != nil {
+		return fmt.Sprintf("%s\nerror: %v", out, err)
+	}
+	return out
+}
+
+// confirm asks on the terminal, so it works while stdin is piped or scripted
+func confirm(question string) bool {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return false
+	}
+	defer tty.Close()
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	line, _ := bufio.NewReader(tty).ReadString('\n')
+	line = strings.ToLower(strings.TrimSpace(line))
+	return line == "y" || line == "yes"
+}
+
+// GetToolResponse sends the messages with the Tools, running the calls the model
+// makes and sending back their results until it responds with text
+func GetToolResponse(client *gpt3.Client, ctx context.Context, messages []gpt3.ChatCompletionMessage) ([]string, error) {
+	messages = append([]gpt3.ChatCompletionMessage(nil), messages...)
+	var usage gpt3.Usage
+	for round := 0; ; round++ {
+		req := newChatRequest(messages, chatFlags())
+		// after enough rounds the model has to answer with what it has
+		if round < maxToolRounds {
+			req.Tools = apiTools()
+		}
+		resp, err := client.CreateChatCompletion(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.CompletionTokens += resp.Usage.CompletionTokens
+		usage.TotalTokens += resp.Usage.TotalTokens
+		LastUsage = usage
+		LastFingerprint = resp.SystemFingerprint
+		if len(resp.Choices) == 0 {
+			return nil, fmt.Errorf("no choices in the response")
+		}
+
+		msg := resp.Choices[0].Message
+		if len(msg.ToolCalls) == 0 {
+			LastLogprobs = chatLogprobs(resp.Choices[0].LogProbs)
+			var r []string
+			for _, c := range resp.Choices {
+				r = append(r, c.Message.Content)
+			}
+			return r, nil
+		}
+
+		messages = append(messages, msg)
+		for _, call := range msg.ToolCalls {
+			messages = append(messages, gpt3.ChatCompletionMessage{
+				Role:       gpt3.ChatMessageRoleTool,
+				Content:    CallTool(call),
+				ToolCallID: call.ID,
+			})
+		}
+	}
+}
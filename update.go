@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const releasesURL = "https://api.github.com/repos/verdverm/chatgpt/releases/latest"
+
+// CheckForUpdate prints a notice to stderr when a newer release exists.
+// The latest release is cached for a day, when stale it is fetched in the background,
+// and a run that exits first still counts as the day's check
+func CheckForUpdate() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || !strings.HasPrefix(info.Main.Version, "v") {
+		// built from source, nothing to compare against
+		return
+	}
+	current := info.Main.Version
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return
+	}
+	cacheFile := filepath.Join(cacheDir, "chatgpt", "latest-version")
+
+	// cache is "<unix time> <tag>"
+	known := current
+	if b, err := os.ReadFile(cacheFile); err == nil {
+		parts := strings.Fields(string(b))
+		if len(parts) == 2 {
+			ts, _ := strconv.ParseInt(parts[0], 10, 64)
+			if time.Since(time.Unix(ts, 0)) < 24*time.Hour {
+				printUpdateNotice(current, parts[1])
+				return
+			}
+			known = parts[1]
+		}
+	}
+
+	// the check is stamped before it starts, most runs exit before the fetch
+	// finishes, which would otherwise have every run check again
+	os.MkdirAll(filepath.Dir(cacheFile), 0755)
+	writeCache := func(tag string) {
+		os.WriteFile(cacheFile, []byte(fmt.Sprintf("%d %s\n", time.Now().Unix(), tag)), 0644)
+	}
+	writeCache(known)
+
+	go func() {
+		latest, err := fetchLatestRelease()
+		if err != nil {
+			return
+		}
+		writeCache(latest)
+		printUpdateNotice(current, latest)
+	}()
+}
+
+func fetchLatestRelease() (string, error) {
+	client := &http.Client{Timeout: 5 * time.Second, Transport: apiTransport}
+	resp, err := client.Get(releasesURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("release check: %s", resp.Status)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&release)
+	if err != nil {
+		return "", err
+	}
+	return release.TagName, nil
+}
+
+func printUpdateNotice(current, latest string) {
+	if newerVersion(latest, current) {
+		fmt.Fprintf(os.Stderr, "chatgpt %s is available (you have %s), run: go install github.com/verdverm/chatgpt@latest\n", latest, current)
+	}
+}
+
+// newerVersion reports whether semver a is greater than b, pre-release suffixes are ignored
+func newerVersion(a, b string) bool {
+	parse := func(v string) [3]int {
+		var n [3]int
+		v = strings.TrimPrefix(v, "v")
+		v, _, _ = strings.Cut(v, "-")
+		for i, p := range strings.SplitN(v, ".", 3) {
+			n[i], _ = strconv.Atoi(p)
+		}
+		return n
+	}
+	va, vb := parse(a), parse(b)
+	for i := range va {
+		if va[i] != vb[i] {
+			return va[i] > vb[i]
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	gpt3 "github.com/sashabaranov/go-openai"
+)
+
+// Validating reports whether any --until check is set
+func Validating() bool {
+	return UntilCommand != "" || UntilJSON || UntilMatch != ""
+}
+
+// ValidateResponse runs the --until checks against a response
+func ValidateResponse(response string) error {
+	if UntilJSON && !json.Valid([]byte(strings.TrimSpace(response))) {
+		return fmt.Errorf("response is not valid JSON")
+	}
+
+	if UntilMatch != "" {
+		re, err := regexp.Compile(UntilMatch)
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(response) {
+			return fmt.Errorf("response does not match %q", UntilMatch)
+		}
+	}
+
+	if UntilCommand != "" {
+		// the response is given to the command on stdin
+		cmd := exec.Command("sh", "-c", UntilCommand)
+		cmd.Stdin = strings.NewReader(response)
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+		err := cmd.Run()
+		if err != nil {
+			return fmt.Errorf("%q failed: %v\n%s", UntilCommand, err, strings.TrimSpace(out.String()))
+		}
+	}
+
+	return nil
+}
+
+// ExtractJSON returns the JSON in a response, without code fences or surrounding text.
+// The response is returned as is when no JSON is found
+func ExtractJSON(response string) string {
+	text := strings.TrimSpace(response)
+	if json.Valid([]byte(text)) {
+		return text
+	}
+
+	// the contents of the first code fence
+	if i := strings.Index(text, "```"); i >= 0 {
+		body := text[i+3:]
+		if nl := strings.Index(body, "\n"); nl >= 0 {
+			body = body[nl+1:]
+		}
+		if j := strings.Index(body, "```"); j >= 0 {
+			body = strings.TrimSpace(body[:j])
+			if json.Valid([]byte(body)) {
+				return body
+			}
+		}
+	}
+
+	// the outermost object or array
+	for _, pair := range [][2]string{{"{", "}"}, {"[", "]"}} {
+		i, j := strings.Index(text, pair[0]), strings.LastIndex(text, pair[1])
+		if i >= 0 && j > i && json.Valid([]byte(text[i:j+1])) {
+			return text[i : j+1]
+		}
+	}
+	return response
+}
+
+func correction(err error) string {
+	msg := fmt.Sprintf("That response failed validation: %v\nPlease try again.", err)
+	if UntilJSON {
+		msg += " Respond with only the JSON, no explanation or code fences."
+	}
+	return msg
+}
+
+// GetValidResponse requests responses until they all pass validation,
+// making at most MaxRetries more attempts after the first.
+// With --until-json the responses are reduced to just their JSON
+func GetValidResponse(client *gpt3.Client, ctx context.Context, conv Conversation, question string) ([]string, error) {
+	conv = conv.Copy()
+	var lastErr error
+	for attempt := 1; attempt <= MaxRetries+1; attempt++ {
+		R, err := GetResponse(client, ctx, &conv, question)
+		if err != nil {
+			return nil, err
+		}
+
+		lastErr = nil
+		failed := ""
+		for i, r := range R {
+			// models often wrap JSON in prose or code fences
+			if UntilJSON {
+				r = ExtractJSON(r)
+				R[i] = r
+			}
+			if err := ValidateResponse(r); err != nil {
+				lastErr = err
+				failed = r
+				break
+			}
+		}
+		if lastErr == nil {
+			Notef("validation passed after %d attempt(s)\n", attempt)
+			return R, nil
+		}
+
+		Notef("attempt %d failed validation: %v\n", attempt, lastErr)
+		Logger.Warn("validation failed", "attempt", attempt, "max_retries", MaxRetries, "error", lastErr.Error())
+		if UntilFeedback && !EditMode {
+			// keep the failed response so the model can see what to fix
+			conv.Add(
+				AssistantMessage(strings.TrimSpace(failed)),
+				UserMessage(correction(lastErr)),
+			)
+		}
+	}
+	return nil, fmt.Errorf("no valid response after %d attempts: %w", MaxRetries+1, lastErr)
+}